@@ -2,71 +2,78 @@ package aiagent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"sync/atomic"
 
-	aiplatform "cloud.google.com/go/aiplatform/apiv1"
-	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/minherz/aichallenges/challenge1/pkg/utils"
-	opt "google.golang.org/api/option"
-	"google.golang.org/protobuf/types/known/structpb"
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+	"github.com/minherz/aichallenges/shared/utils"
 )
 
-const (
-	endpointIDEnvVar       = "ENDPOINT_ID"
-	endpointLocationEnvVar = "REGION_NAME"
-	modelEndpointTemplate  = "projects/%s/locations/%s/endpoints/%s"
-)
+// defaultModelName is the Gemini model that is used when the backend is Gemini and the model name is not set
+const defaultModelName = "gemini-1.5-flash-001"
 
 var (
-	modelParameters = map[string]interface{}{
-		"temperature":     0.1,
-		"maxInputTokens":  2048,
-		"maxOutputTokens": 2048,
+	systemInstructions = []string{
+		"Ensure your answers are concise.",
+		"Return answer as html without backticks.",
 	}
 )
 
 type Agent struct {
-	c           *aiplatform.PredictionClient
-	endpointUri string
-	sessions    map[string]*ChatSession
+	m llm.Model
+	// model is the model before the guardrails are attached; RegisterHealth pings it directly
+	model  llm.Model
+	guards *guardrails.Set
+	// config is replaced when the configuration file changes
+	config   atomic.Pointer[Config]
+	mu       sync.Mutex
+	sessions map[string]*ChatSession
 }
 
 type ChatSession struct {
-	id       string
-	messages *Chat
+	id   string
+	chat *llm.Chat
 }
 
-func NewAgent(ctx context.Context, e *echo.Echo) (*Agent, error) {
-	var (
-		c   *aiplatform.PredictionClient
-		err error
-	)
-	projectID := utils.GetEnvOrDefault("PROJECT_ID", utils.GetEnvOrDefault("GOOGLE_CLOUD_PROJECT", ""))
-	if projectID == "" {
-		if projectID, err = utils.ProjectID(ctx); err != nil {
+// NewAgent creates the agent with the configuration that is validated by config.Load.
+// Vertex AI models use the project and the region discovered by env.
+func NewAgent(ctx context.Context, e *echo.Echo, c *Config, env *utils.Environment) (*Agent, error) {
+	var err error
+
+	cfg := c.Model.LLMConfig()
+	if cfg.Backend == llm.BackendGemini && cfg.ModelName == "" {
+		cfg.ModelName = defaultModelName
+	}
+	cfg.Parameters = map[string]interface{}{
+		"maxInputTokens": c.MaxInputTokens,
+	}
+	if cfg.Backend != llm.BackendOpenAI {
+		if cfg.ProjectID, err = env.ProjectID(ctx); err != nil {
 			return nil, fmt.Errorf("could not retrieve current project ID: %w", err)
 		}
+		if cfg.Region, err = env.Region(ctx); err != nil {
+			return nil, fmt.Errorf("could not retrieve location of the model: %w", err)
+		}
 	}
-	region := utils.GetEnvOrDefault(endpointLocationEnvVar, "")
-	if region == "" {
-		return nil, fmt.Errorf("could not retrieve model location from environment")
-	}
-	modelEndpointID := utils.GetEnvOrDefault(endpointIDEnvVar, "")
-	if modelEndpointID == "" {
-		return nil, fmt.Errorf("could not retrieve model endpoint ID from environment")
+	m, err := llm.New(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
-	endpointUrl := fmt.Sprintf("%s-aiplatform.googleapis.com:443", region)
-	c, err = aiplatform.NewPredictionClient(ctx, opt.WithEndpoint(endpointUrl))
+	guards, err := guardrails.New(ctx, c.Guardrails, guardrails.Options{ProjectID: cfg.ProjectID, Model: m})
 	if err != nil {
-		return nil, fmt.Errorf("could not initialize AI client: %w", err)
+		return nil, err
 	}
-	endpointUri := fmt.Sprintf(modelEndpointTemplate, projectID, region, modelEndpointID)
-	agent := &Agent{c: c, endpointUri: endpointUri, sessions: make(map[string]*ChatSession)}
-	slog.Debug("initialized ai agent", "project", projectID, "region", region, "endpoint_id", modelEndpointID)
+	agent := &Agent{m: llm.WithCallbacks(m, guards.Callbacks()), model: m, guards: guards, sessions: make(map[string]*ChatSession)}
+	agent.config.Store(c)
+	slog.Debug("initialized ai agent", "project", cfg.ProjectID, "region", cfg.Region, "backend", cfg.Backend, "model", m.Name())
 
 	// setup handlers
 	e.POST("/ask", agent.onAsk)
@@ -74,53 +81,34 @@ func NewAgent(ctx context.Context, e *echo.Echo) (*Agent, error) {
 	return agent, nil
 }
 
-func (a *Agent) Close() {
-	if a.c != nil {
-		a.Close()
-	}
+// Reconfigure applies the changed generation parameters and system instructions to the next requests.
+func (a *Agent) Reconfigure(c *Config) {
+	a.config.Store(c)
 }
 
-// SendMessage sends prompt following https://cloud.google.com/vertex-ai/generative-ai/docs/text/test-text-prompts
-func (a *Agent) SendMessage(ctx context.Context, msg string) (string, error) {
-	promptValue, err := structpb.NewValue(map[string]interface{}{
-		"inputs": msg,
+// RegisterHealth adds the model probe and the model name to the health endpoints.
+func (a *Agent) RegisterHealth(h *utils.Health) {
+	h.SetModel("chat", a.model.Name())
+	h.AddProbe("model", func(ctx context.Context) error {
+		return llm.Ping(ctx, a.model)
 	})
-	if err != nil {
-		return "", fmt.Errorf("failed to convert prompt %q to Value: %w", msg, err)
-	}
-	parametersValue, err := structpb.NewValue(modelParameters)
-	if err != nil {
-		return "", fmt.Errorf("unable to convert parameters to Value: %w", err)
-	}
-	slog.Debug("predict request data",
-		"endpoint", a.endpointUri,
-		"inputs", msg,
-		"parameters", fmt.Sprintf("%v", modelParameters))
-	r := &aiplatformpb.PredictRequest{
-		Endpoint:   a.endpointUri,
-		Instances:  []*structpb.Value{promptValue},
-		Parameters: parametersValue,
-	}
-	resp, err := a.c.Predict(ctx, r)
-	if err != nil {
-		return "", fmt.Errorf("model failed to respond: %w", err)
+}
+
+func (a *Agent) Close() {
+	if a.m != nil {
+		a.m.Close()
 	}
-	if len(resp.Predictions) == 0 {
-		return "", fmt.Errorf("model returned empty response: %v", resp)
+	if a.guards != nil {
+		a.guards.Close()
 	}
-	slog.Debug("predict response data",
-		"response_0", resp.Predictions[0].GetStringValue(),
-		"response_count", len(resp.Predictions),
-		"model", resp.ModelDisplayName,
-		"model_version", resp.ModelVersionId,
-		"metadata", fmt.Sprintf("%v", resp.Metadata))
-	return resp.Predictions[0].GetStringValue(), nil
 }
 
 func (a *Agent) getOrCreateSession(id string) *ChatSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	s, ok := a.sessions[id]
 	if !ok {
-		s = &ChatSession{id: id, messages: NewChat(a.SendMessage)}
+		s = &ChatSession{id: id, chat: llm.NewChat(a.m)}
 		a.sessions[id] = s
 	}
 	return s
@@ -135,17 +123,26 @@ type AskRequest struct {
 	Message   string `json:"message,omitempty"`
 	Location  string `json:"loc,omitempty"`
 	Company   string `json:"company,omitempty"`
+	// GenerationParameters override the configured parameters for this request
+	config.GenerationParameters
 }
 
 type AskResponse struct {
 	BaseResponse
 	SessionID string `json:"session,omitempty"`
-	Message   string `json:"message,omitempty"`
+	// Message is the plain text version of the response
+	Message string `json:"message,omitempty"`
+	// HTML is the sanitized response that is safe to render as HTML
+	HTML string `json:"html,omitempty"`
+	// FinishReason tells if the response was blocked or truncated
+	FinishReason llm.FinishReason `json:"finish_reason,omitempty"`
+	// Generation holds the generation parameters that were applied to the request
+	Generation *config.GenerationParameters `json:"generation,omitempty"`
 }
 
 func (a *Agent) onAsk(ectx echo.Context) error {
 	r := &AskRequest{}
-	if err := ectx.Bind(&r); err != nil {
+	if err := ectx.Bind(r); err != nil {
 		return reportError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
 	}
 	if r.Message == "" {
@@ -159,11 +156,21 @@ func (a *Agent) onAsk(ectx echo.Context) error {
 		r.SessionID = id
 	}
 	s := a.getOrCreateSession(r.SessionID)
-	response, err := s.messages.SendMessage(ectx.Request().Context(), r.Message)
+	req := llm.UserMessage(r.Message)
+	c := a.config.Load()
+	req.SystemInstruction = c.Instructions
+	req.Config = c.Generation.Limits.Override(c.Generation.LLMConfig(), r.GenerationParameters)
+	req.SafetySettings = a.guards.Safety
+	ctx := llm.ContextWithSession(ectx.Request().Context(), r.SessionID)
+	response, err := s.chat.Send(ctx, req)
 	if err != nil {
+		if errors.Is(err, guardrails.ErrPromptInjection) {
+			return reportError(ectx, http.StatusBadRequest, guardrails.ErrPromptInjection)
+		}
 		return reportError(ectx, http.StatusInternalServerError, fmt.Errorf("chat response error: %w", err))
 	}
-	return ectx.JSON(http.StatusOK, AskResponse{SessionID: r.SessionID, Message: response})
+	f := guardrails.FormatModelResponse(response)
+	return ectx.JSON(http.StatusOK, AskResponse{SessionID: r.SessionID, Message: f.Text, HTML: f.HTML, FinishReason: response.FinishReason, Generation: config.Parameters(req.Config)})
 }
 
 func newID() (string, error) {
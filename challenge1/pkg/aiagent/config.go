@@ -0,0 +1,65 @@
+package aiagent
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Config is the configuration of the service.
+// The generation parameters, the system instructions and the log level are applied without restart.
+type Config struct {
+	Server     config.Server     `yaml:"server"`
+	Model      config.Model      `yaml:"model"`
+	Generation config.Generation `yaml:"generation" hot:"true"`
+	// Instructions are the system instructions of the chat
+	Instructions string `yaml:"instructions" env:"SYSTEM_INSTRUCTIONS" hot:"true"`
+	// MaxInputTokens is the prediction parameter of the deployed Gemma model
+	MaxInputTokens int               `yaml:"max_input_tokens" env:"MAX_INPUT_TOKENS"`
+	Guardrails     config.Guardrails `yaml:"guardrails"`
+}
+
+// DefaultConfig returns the configuration that is used when neither the configuration file
+// nor the environment variables set the values.
+func DefaultConfig() *Config {
+	limits := config.DefaultGenerationLimits()
+	limits.MaxOutputTokens = 2048
+	return &Config{
+		Server: config.DefaultServer(),
+		Model:  config.Model{Backend: llm.BackendGemma},
+		Generation: config.Generation{
+			Temperature:     ptr[float32](0.1),
+			MaxOutputTokens: ptr[int32](2048),
+			Limits:          limits,
+		},
+		Instructions:   strings.Join(systemInstructions, ""),
+		MaxInputTokens: 2048,
+		Guardrails: config.Guardrails{
+			Redactor:        guardrails.RedactorLocal,
+			InjectionAction: guardrails.InjectionActionBlock,
+			TopicGuard:      guardrails.TopicGuardKeywords,
+		},
+	}
+}
+
+func (c *Config) Validate() error {
+	errs := []error{c.Server.Validate(), c.Model.Validate(), c.Generation.Validate(), c.Guardrails.Validate()}
+	if strings.TrimSpace(c.Instructions) == "" {
+		errs = append(errs, errors.New("instructions are empty"))
+	}
+	if strings.EqualFold(c.Guardrails.TopicGuard, guardrails.TopicGuardEmbedding) {
+		// the agent has no embedding model
+		errs = append(errs, errors.New("guardrails.topic_guard embedding is not supported"))
+	}
+	if c.Model.Backend == llm.BackendGemma && c.Model.EndpointID == "" {
+		errs = append(errs, errors.New("model.endpoint_id is required for Gemma model"))
+	}
+	return errors.Join(errs...)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
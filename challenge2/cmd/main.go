@@ -1,103 +1,55 @@
 package main
 
 import (
-	"context"
+	"flag"
 	"log/slog"
-	"net/http"
 	"os"
-	"os/signal"
-	"strings"
-	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	"github.com/minherz/aichallenges/challenge2/pkg/aiagent"
+	"github.com/minherz/aichallenges/challenge2/web"
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/utils"
 )
 
-var (
-	logLevel *slog.LevelVar
-)
-
-func setupLogger() {
-	logLevel = &slog.LevelVar{}
-	opts := &slog.HandlerOptions{
-		Level: logLevel,
-		ReplaceAttr: func(group []string, a slog.Attr) slog.Attr {
-			if a.Key == slog.LevelKey {
-				return slog.Attr{Key: "severity", Value: a.Value}
-			}
-			if a.Key == slog.MessageKey {
-				return slog.Attr{Key: "message", Value: a.Value}
-			}
-			return slog.Attr{Key: a.Key, Value: a.Value}
-		},
-	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, opts))
-	slog.SetDefault(logger)
-
-	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
-	case "debug":
-		logLevel.Set(slog.LevelDebug)
-	case "info":
-		logLevel.Set(slog.LevelInfo)
-	case "warn":
-		logLevel.Set(slog.LevelWarn)
-	case "error":
-		logLevel.Set(slog.LevelError)
-	}
-}
-
 func main() {
-	setupLogger()
-	e := echo.New()
-	if os.Getenv("DO_DEBUG") != "" {
-		e.Use(middleware.Logger())
-		logLevel.Set(slog.LevelDebug)
+	env := &utils.Environment{}
+	env.Flags.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	logLevel := utils.SetupLogger()
+	path := os.Getenv(config.FileEnvVar)
+	cfg := aiagent.DefaultConfig()
+	settings, err := config.Load(path, cfg)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err, "path", path)
+		os.Exit(1)
+	}
+	logLevel.Set(cfg.Server.Level())
+	config.Log(path, settings)
+	env.Config = utils.Location{ProjectID: cfg.Model.ProjectID, Region: cfg.Model.Region}
+	assets, err := utils.NewAssets(web.Static(), cfg.Server.StaticDir)
+	if err != nil {
+		slog.Error("cannot load static files", "error", err)
+		os.Exit(1)
 	}
-	e.Use(
-		middleware.CORSWithConfig(middleware.CORSConfig{
-			AllowOrigins: []string{"*"},
-		}),
-		middleware.StaticWithConfig(middleware.StaticConfig{
-			Root:  "web/static",
-			HTML5: true,
-		}),
-		middleware.GzipWithConfig(middleware.GzipConfig{
-			Level: 5,
-		}),
-		middleware.Secure(),
-	)
-	e.IPExtractor = echo.ExtractIPFromXFFHeader(
-		echo.TrustLoopback(false),   // e.g. ipv4 start with 127.
-		echo.TrustLinkLocal(false),  // e.g. ipv4 start with 169.254
-		echo.TrustPrivateNet(false), // e.g. ipv4 start with 10. or 192.168
-	)
+	e := utils.NewServer(cfg.Server, assets)
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := utils.SignalContext()
 	defer stop()
-	agent, err := aiagent.NewAgent(ctx, e)
+	agent, err := aiagent.NewAgent(ctx, e, cfg, env)
 	if err != nil {
 		e.Logger.Fatal("failed to initialize Vertex AI agent: %q", err.Error())
 	}
-
-	// Start server
-	go func() {
-		port := os.Getenv("PORT")
-		if port == "" {
-			port = "8080"
-		}
-		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
-		}
-	}()
-
-	// Wait for interrupt signal and gracefully shutdown the server after 5 seconds.
-	<-ctx.Done()
-	agent.Close()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := e.Shutdown(ctx); err != nil {
+	defer agent.Close()
+	health := utils.NewHealth("challenge2", settings)
+	agent.RegisterHealth(health)
+	health.Register(e)
+	config.Watch(ctx, path, config.DefaultWatchInterval, aiagent.DefaultConfig, cfg, func(c *aiagent.Config) {
+		logLevel.Set(c.Server.Level())
+		agent.Reconfigure(c)
+	})
+
+	// serve until the interrupt signal and gracefully shutdown the server
+	if err := utils.Serve(ctx, e, cfg.Server.Port); err != nil {
 		e.Logger.Fatal(err)
 	}
 }
@@ -0,0 +1,84 @@
+package aiagent
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/minherz/aichallenges/challenge2/pkg/instructions"
+)
+
+type InstructionsResponse struct {
+	BaseResponse
+	Current  *instructions.Version   `json:"current,omitempty"`
+	Pinned   bool                    `json:"pinned"`
+	Versions []*instructions.Version `json:"versions,omitempty"`
+	History  []instructions.Event    `json:"history,omitempty"`
+}
+
+// ActivateRequest activates the version by its ID or the name of the file in the versions directory.
+type ActivateRequest struct {
+	Version string `json:"version"`
+	// Pin keeps the version active when the current instructions file changes
+	Pin bool `json:"pin,omitempty"`
+}
+
+// registerAdmin sets up the endpoints that manage the system instructions.
+// The requests are authorized with the token in "Authorization: Bearer <token>" header.
+func (a *Agent) registerAdmin(e *echo.Echo, token string) {
+	g := e.Group("/admin", middleware.KeyAuth(func(key string, _ echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1, nil
+	}))
+	g.GET("/instructions", a.onInstructions)
+	g.POST("/instructions/activate", a.onActivateInstructions)
+	g.POST("/instructions/unpin", a.onUnpinInstructions)
+}
+
+func (a *Agent) onInstructions(ectx echo.Context) error {
+	versions, err := a.instructions.Versions()
+	if err != nil {
+		return reportAdminError(ectx, http.StatusInternalServerError, fmt.Errorf("cannot list instructions versions: %w", err))
+	}
+	return ectx.JSON(http.StatusOK, InstructionsResponse{
+		Current:  a.instructions.Current(),
+		Pinned:   a.instructions.Pinned(),
+		Versions: versions,
+		History:  a.instructions.History(),
+	})
+}
+
+func (a *Agent) onActivateInstructions(ectx echo.Context) error {
+	r := &ActivateRequest{}
+	if err := ectx.Bind(r); err != nil {
+		return reportAdminError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
+	}
+	if r.Version == "" {
+		return reportAdminError(ectx, http.StatusBadRequest, fmt.Errorf("request version is empty"))
+	}
+	v, err := a.instructions.Activate(r.Version, r.Pin, ectx.RealIP())
+	if errors.Is(err, instructions.ErrNotFound) {
+		return reportAdminError(ectx, http.StatusNotFound, err)
+	}
+	if err != nil {
+		return reportAdminError(ectx, http.StatusInternalServerError, err)
+	}
+	return ectx.JSON(http.StatusOK, InstructionsResponse{Current: v, Pinned: a.instructions.Pinned()})
+}
+
+func (a *Agent) onUnpinInstructions(ectx echo.Context) error {
+	v, err := a.instructions.Unpin(ectx.RealIP())
+	if err != nil {
+		return reportAdminError(ectx, http.StatusInternalServerError, fmt.Errorf("cannot reload system instructions: %w", err))
+	}
+	return ectx.JSON(http.StatusOK, InstructionsResponse{Current: v, Pinned: false})
+}
+
+func reportAdminError(ectx echo.Context, code int, err error) error {
+	msg := err.Error()
+	slog.Error(msg, "response_code", code)
+	return ectx.JSON(code, InstructionsResponse{BaseResponse: BaseResponse{Error: msg}})
+}
@@ -2,26 +2,36 @@ package aiagent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"cloud.google.com/go/vertexai/genai"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/minherz/aichallenges/challenge2/pkg/utils"
+	"github.com/minherz/aichallenges/challenge2/pkg/documents"
+	"github.com/minherz/aichallenges/challenge2/pkg/instructions"
+	"github.com/minherz/aichallenges/challenge2/pkg/itinerary"
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/embedding"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+	"github.com/minherz/aichallenges/shared/utils"
 )
 
 const (
-	modelNameEnvVar             = "GEMINI_MODEL_NAME"
-	regionEnvVar                = "REGION_NAME"
-	systemInstructionPathEnvVar = "SYS_INSTRUCTION_PATH"
-	systemInstructionFilePath   = "current/system_instructions.txt"
 	// from https://cloud.google.com/vertex-ai/generative-ai/docs/learn/model-versions
 	defaultModelName = "gemini-1.5-flash-001"
+	// embeddingProviderNone disables document uploads
+	embeddingProviderNone = "none"
+	defaultSessionTTL     = 30 * time.Minute
+	// instructionsGracePeriod is the time that the file watcher has to apply the change of the instructions file
+	instructionsGracePeriod = 30 * time.Second
 )
 
 var (
@@ -36,125 +46,310 @@ var (
 )
 
 type Agent struct {
-	c        *genai.Client
-	m        *genai.GenerativeModel
-	sessions map[string]*ChatSession
-	w        *utils.FileWatcher
+	m llm.Model
+	// model skips the guardrails and the response logging, so the health probes are neither refused nor logged
+	model        llm.Model
+	guards       *guardrails.Set
+	instructions *instructions.Store
+	// config is the snapshot of the model configuration that is replaced when the instructions change
+	config atomic.Pointer[modelConfig]
+	// sessionPolicy defines whether sessions use the latest config or the one they started with
+	sessionPolicy string
+	itineraries   *itinerary.Generator
+	// embedder is nil when document uploads are disabled
+	embedder embedding.Embedder
+	// embeddingModel is the name of the embedding model or the provider if it has no models
+	embeddingModel string
+	// maxAttachmentSize is the size limit of the attached file in bytes
+	maxAttachmentSize int64
+	// maxSessionAttachmentsSize is the size limit of all files attached in the session in bytes
+	maxSessionAttachmentsSize int64
+	// maxDocumentSize is the size limit of the uploaded document in bytes
+	maxDocumentSize int64
+	// sessionTTL is the time after the last request when the session expires
+	sessionTTL time.Duration
+	mu         sync.Mutex
+	sessions   map[string]*ChatSession
+	w          *utils.FileWatcher
 }
 
 type ChatSession struct {
 	id   string
-	chat *genai.ChatSession
+	chat *llm.Chat
+	// config is the model configuration that was active when the session was created
+	config *modelConfig
+	// persona is bound to the session with the first successful exchange; guarded by Agent.mu
+	persona      string
+	personaBound bool
+	// claimedPersona is used by the first exchanges that are in progress; guarded by Agent.mu
+	claimedPersona string
+	personaClaims  int
+	// documents are uploaded by the user; nil when document uploads are disabled
+	documents *documents.Index
+	// itinerary is the last itinerary generated from the session; guarded by Agent.mu
+	itinerary *itinerary.Itinerary
+	// lastUsed is the time of the last request in the session; guarded by Agent.mu
+	lastUsed time.Time
+	// attachmentsSize is the size of the files in the chat history in bytes; guarded by Agent.mu
+	attachmentsSize int64
 }
 
-func NewAgent(ctx context.Context, e *echo.Echo) (*Agent, error) {
+// NewAgent creates the agent with the configuration that is validated by config.Load.
+// Vertex AI models use the project and the region discovered by env.
+func NewAgent(ctx context.Context, e *echo.Echo, c *Config, env *utils.Environment) (*Agent, error) {
 	var (
-		c            *genai.Client
-		m            *genai.GenerativeModel
-		w            *utils.FileWatcher
-		err          error
-		instructions string
+		w   *utils.FileWatcher
+		err error
 	)
-	projectID := utils.GetenvWithDefault("PROJECT_ID", utils.GetenvWithDefault("GOOGLE_CLOUD_PROJECT", ""))
-	if projectID == "" {
-		if projectID, err = utils.ProjectID(ctx); err != nil {
+	cfg := c.Model.LLMConfig()
+	embeddingProvider := c.embeddingProvider()
+	if cfg.Backend != llm.BackendOpenAI || embeddingProvider == embedding.ProviderVertex {
+		if cfg.ProjectID, err = env.ProjectID(ctx); err != nil {
 			return nil, fmt.Errorf("could not retrieve current project ID: %w", err)
 		}
-	}
-	region := utils.GetenvWithDefault(regionEnvVar, "")
-	if region == "" {
-		if region, err = utils.Region(ctx); err != nil {
+		if cfg.Region, err = env.Region(ctx); err != nil {
 			return nil, fmt.Errorf("could not retrieve location from the model: %w", err)
 		}
 	}
-	if c, err = genai.NewClient(ctx, projectID, region); err != nil {
-		return nil, fmt.Errorf("could not initialize Vertex AI client: %w", err)
-	}
-	modelName := utils.GetenvWithDefault(modelNameEnvVar, defaultModelName)
-	m = c.GenerativeModel(modelName)
-	path := utils.GetenvWithDefault(systemInstructionPathEnvVar, "")
-	if path != "" {
-		path := filepath.Join(path, systemInstructionFilePath)
-		if text, err := os.ReadFile(path); err == nil {
-			instructions = string(text)
-			w, _ = utils.NewFileWatcher(path)
+	m, err := llm.New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	root := c.Instructions.Path
+	store := instructions.NewStore(root, strings.Join(defaultSystemInstructions, " "))
+	personas := instructions.NewPersonas(root)
+	var watched []string
+	if store.Current().Source != instructions.SourceDefault {
+		watched = append(watched, store.Path())
+	}
+	// the directory is resolved once, so the events are routed correctly after it is removed
+	personasDir := personas.Dir()
+	if personasDir != "" {
+		watched = append(watched, personasDir)
+	}
+	if len(watched) > 0 {
+		if w, err = utils.NewFileWatcher(watched...); err != nil {
+			return nil, err
 		}
+		w.Mode = c.Instructions.Watch
+	}
+	var embedder embedding.Embedder
+	if embeddingProvider != embeddingProviderNone {
+		ecfg, err := c.Embedding.EmbeddingConfig()
+		if err != nil {
+			return nil, err
+		}
+		ecfg.Provider, ecfg.ProjectID, ecfg.Region = embeddingProvider, cfg.ProjectID, cfg.Region
+		if embedder, err = embedding.New(ctx, ecfg); err != nil {
+			return nil, err
+		}
+	}
+	opts := guardrails.Options{ProjectID: cfg.ProjectID, Model: m}
+	if embedder != nil {
+		opts.Embed = embedder.EmbedQuery
+	}
+	guards, err := guardrails.New(ctx, c.Guardrails, opts)
+	if err != nil {
+		return nil, err
+	}
+	sessionPolicy, err := parseSessionPolicy(c.Instructions.SessionPolicy)
+	if err != nil {
+		return nil, err
 	}
-	if instructions == "" {
-		instructions = strings.Join(defaultSystemInstructions, " ")
+	model := m
+	m = llm.WithCallbacks(m, guards.Callbacks())
+	agent := &Agent{
+		m:            m,
+		model:        model,
+		guards:       guards,
+		embedder:     embedder,
+		instructions: store,
+		itineraries:  itinerary.NewGenerator(m, c.ItineraryMaxAttempts, guards.Safety),
+		w:            w,
+		sessions:     make(map[string]*ChatSession),
+
+		maxAttachmentSize:         c.AttachmentMaxSize,
+		maxSessionAttachmentsSize: c.SessionAttachmentsMaxSize,
+		maxDocumentSize:           c.DocumentMaxSize,
+		sessionTTL:                c.SessionTTL,
+		sessionPolicy:             sessionPolicy,
 	}
-	m.SystemInstruction = &genai.Content{
-		Parts: []genai.Part{genai.Text(instructions)},
+	if embedder != nil {
+		agent.embeddingModel = c.Embedding.Model
+		if embeddingProvider != embedding.ProviderVertex {
+			agent.embeddingModel = embeddingProvider
+		}
 	}
-	slog.Debug("system instructions have been set", "instructions", instructions)
-	agent := &Agent{c: c, m: m, w: w, sessions: make(map[string]*ChatSession)}
+	agent.updateConfig(func(m *modelConfig) {
+		m.safety = guards.Safety
+		m.generation = c.Generation
+	})
+	store.OnActivate(func(v *instructions.Version) {
+		agent.updateConfig(func(m *modelConfig) { m.instructions = v })
+	})
+	personas.OnChange(func(p map[string]*instructions.Version) {
+		agent.updateConfig(func(m *modelConfig) { m.personas = p })
+	})
 	if w != nil {
-		w.Watch(ctx, agent.loadSystemInstructions)
+		w.Watch(ctx, func(path string) {
+			path = filepath.Clean(path)
+			if personasDir != "" && (path == personasDir || filepath.Dir(path) == personasDir) {
+				personas.Reload(path)
+				return
+			}
+			store.Reload(path)
+		})
+	}
+	if c.SessionTTL > 0 {
+		go agent.expireSessions(ctx)
 	}
-	slog.Debug("initialized ai agent", "project", projectID, "region", region, "mode_name", modelName, "system_instructions", instructions)
+	slog.Debug("initialized ai agent", "project", cfg.ProjectID, "region", cfg.Region, "backend", cfg.Backend, "model", m.Name(), "instructions_version", store.Current().ID)
 
 	// setup handlers
 	e.POST("/ask", agent.onAsk)
+	e.POST("/documents", agent.onUpload)
+	e.GET("/personas", agent.onPersonas)
+	e.POST("/itinerary", agent.onItinerary)
+	e.GET("/itinerary/export", agent.onExport)
+	e.POST("/itinerary/export", agent.onExport)
+	if c.AdminToken != "" {
+		agent.registerAdmin(e, c.AdminToken)
+	}
 
 	return agent, nil
 }
 
+// Reconfigure applies the changed generation parameters to the next requests.
+func (a *Agent) Reconfigure(c *Config) {
+	a.updateConfig(func(m *modelConfig) { m.generation = c.Generation })
+}
+
+// RegisterHealth adds the probes of the model, the embedding model and the system instructions
+// to the health endpoints.
+func (a *Agent) RegisterHealth(h *utils.Health) {
+	h.SetModel("chat", a.model.Name())
+	h.AddProbe("model", func(ctx context.Context) error {
+		return llm.Ping(ctx, a.model)
+	})
+	if a.embedder != nil {
+		h.SetModel("embedding", a.embeddingModel)
+		h.AddProbe("embedding", func(ctx context.Context) error {
+			_, err := a.embedder.EmbedQuery(ctx, "ping")
+			return err
+		})
+	}
+	h.AddProbe("instructions", func(_ context.Context) error {
+		return a.instructions.Fresh(instructionsGracePeriod)
+	})
+}
+
 func (a *Agent) Close() {
 	if a.w != nil {
 		a.w.Stop()
 	}
-	if a.c != nil {
-		a.Close()
+	if a.m != nil {
+		a.m.Close()
+	}
+	if a.embedder != nil {
+		a.embedder.Close()
+	}
+	if a.guards != nil {
+		a.guards.Close()
 	}
 }
 
 func (a *Agent) getOrCreateSession(id string) *ChatSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	s, ok := a.sessions[id]
 	if !ok {
-		s = &ChatSession{id: id, chat: a.m.StartChat()}
+		s = &ChatSession{id: id, chat: llm.NewChat(a.m), config: a.config.Load()}
+		if a.embedder != nil {
+			s.documents = documents.NewIndex(a.embedder, maxSessionChunks)
+		}
 		a.sessions[id] = s
 	}
+	s.lastUsed = time.Now()
 	return s
 }
 
-func (a *Agent) loadSystemInstructions(path string) {
-	text, err := os.ReadFile(path)
-	if err != nil {
-		slog.Error("failed to read system instructions", "error", err, "path", path)
-		return
+func (a *Agent) getSession(id string) (*ChatSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[id]
+	if ok {
+		s.lastUsed = time.Now()
 	}
-	instructions := string(text)
-	a.m.SystemInstruction = &genai.Content{
-		Parts: []genai.Part{genai.Text(instructions)},
+	return s, ok
+}
+
+// expireSessions removes the sessions that were not used for sessionTTL
+// together with their history and documents.
+func (a *Agent) expireSessions(ctx context.Context) {
+	t := time.NewTicker(min(a.sessionTTL, time.Minute))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			a.mu.Lock()
+			for id, s := range a.sessions {
+				if now.Sub(s.lastUsed) > a.sessionTTL {
+					delete(a.sessions, id)
+					slog.Debug("session expired", "session", id, "last_used", s.lastUsed)
+				}
+			}
+			a.mu.Unlock()
+		}
 	}
-	slog.Debug("system instructions have been updated", "instructions", instructions)
 }
 
 type BaseResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
+// AskRequest is sent as JSON or, with attached files, as multipart form.
 type AskRequest struct {
-	SessionID string `json:"session,omitempty"`
-	Message   string `json:"message,omitempty"`
-	Location  string `json:"loc,omitempty"`
-	Company   string `json:"company,omitempty"`
+	SessionID string `json:"session,omitempty" form:"session"`
+	Message   string `json:"message,omitempty" form:"message"`
+	Location  string `json:"loc,omitempty" form:"loc"`
+	Company   string `json:"company,omitempty" form:"company"`
+	// Persona selects the assistant for the session. It is bound to the session with the first message.
+	Persona string `json:"persona,omitempty" form:"persona"`
+	// GenerationParameters override the configured parameters for this request
+	config.GenerationParameters
 }
 
 type AskResponse struct {
 	BaseResponse
 	SessionID string `json:"session,omitempty"`
-	Message   string `json:"message,omitempty"`
+	// InstructionsVersion is the ID of the system instructions used for the response
+	InstructionsVersion string `json:"instructions_version,omitempty"`
+	// Persona is the assistant of the session; empty for the default assistant
+	Persona string `json:"persona,omitempty"`
+	// Message is the plain text version of the response
+	Message string `json:"message,omitempty"`
+	// HTML is the sanitized response that is safe to render as HTML
+	HTML string `json:"html,omitempty"`
+	// FinishReason tells if the response was blocked or truncated
+	FinishReason llm.FinishReason `json:"finish_reason,omitempty"`
+	// Generation holds the generation parameters that were applied to the request
+	Generation *config.GenerationParameters `json:"generation,omitempty"`
 }
 
 func (a *Agent) onAsk(ectx echo.Context) error {
 	r := &AskRequest{}
-	if err := ectx.Bind(&r); err != nil {
+	if err := ectx.Bind(r); err != nil {
 		return reportError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
 	}
 	if r.Message == "" {
 		return reportError(ectx, http.StatusBadRequest, fmt.Errorf("request message is empty"))
 	}
+	blobs, err := a.readAttachments(ectx)
+	if err != nil {
+		return reportError(ectx, attachmentErrorCode(err), err)
+	}
 	if r.SessionID == "" {
 		id, err := newID()
 		if err != nil {
@@ -163,13 +358,55 @@ func (a *Agent) onAsk(ectx echo.Context) error {
 		r.SessionID = id
 	}
 	s := a.getOrCreateSession(r.SessionID)
-	response, err := s.chat.SendMessage(ectx.Request().Context(), genai.Text(r.Message))
+	release, err := a.reserveAttachments(s, blobs)
+	if err != nil {
+		return reportError(ectx, attachmentErrorCode(err), err)
+	}
+	kept := false
+	defer func() {
+		if !kept {
+			release()
+		}
+	}()
+	req := llm.UserMessage(r.Message)
+	// attachments are kept in the chat history, so follow-up questions can refer to them
+	req.Messages[0].Blobs = blobs
+	cfg := a.sessionConfig(s)
+	persona, bind, err := a.claimPersona(s, r.Persona)
+	if err != nil {
+		return reportError(ectx, personaErrorCode(err), err)
+	}
+	// the persona is bound with the exchange that is kept in the chat history
+	defer func() { bind(kept) }()
+	v, err := cfg.apply(req, persona, r.GenerationParameters)
 	if err != nil {
+		return reportError(ectx, personaErrorCode(err), err)
+	}
+	ctx := llm.ContextWithLogAttrs(llm.ContextWithSession(ectx.Request().Context(), r.SessionID), "instructions_version", v.ID, "persona", persona)
+	if req.SystemInstruction, err = a.documentInstructions(ctx, s, req.SystemInstruction, r.Message); err != nil {
+		return reportError(ectx, http.StatusInternalServerError, err)
+	}
+	response, err := s.chat.Send(ctx, req)
+	if err != nil {
+		if errors.Is(err, guardrails.ErrPromptInjection) {
+			return reportError(ectx, http.StatusBadRequest, guardrails.ErrPromptInjection)
+		}
 		return reportError(ectx, http.StatusInternalServerError, fmt.Errorf("chat response error: %w", err))
 	}
-	msg := utils.ProcessResponse(response)
-	slog.Debug("ask request processed", "session", r.SessionID, "prompt", r.Message, "response", msg)
-	return ectx.JSON(http.StatusOK, AskResponse{SessionID: r.SessionID, Message: msg})
+	// blocked and refused exchanges are not kept in the chat history
+	kept = !response.FinishReason.Blocked() && response.FinishReason != llm.FinishReasonRefused
+	// the prompt and the response are not logged because they can contain personal data; the prompt is redacted only in the model request
+	slog.Debug("ask request processed", "session", r.SessionID, "instructions_version", v.ID, "persona", persona, "attachments", len(blobs), "response_length", len(response.Text), "finish_reason", response.FinishReason)
+	f := guardrails.FormatModelResponse(response)
+	return ectx.JSON(http.StatusOK, AskResponse{
+		SessionID:           r.SessionID,
+		InstructionsVersion: v.ID,
+		Persona:             persona,
+		Message:             f.Text,
+		HTML:                f.HTML,
+		FinishReason:        response.FinishReason,
+		Generation:          config.Parameters(req.Config),
+	})
 }
 
 func newID() (string, error) {
@@ -0,0 +1,87 @@
+package aiagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/shared/fake"
+	"github.com/minherz/aichallenges/shared/llm"
+	"github.com/minherz/aichallenges/shared/utils"
+)
+
+func newTestAgent(t *testing.T, rules ...fake.Rule) (*echo.Echo, *fake.Server) {
+	t.Helper()
+	s, err := fake.NewServer(fake.Script{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	t.Setenv(llm.EmulatorHostEnvVar, s.GRPCAddr())
+
+	c := DefaultConfig()
+	c.Embedding.Provider = embeddingProviderNone
+	env := &utils.Environment{Config: utils.Location{ProjectID: "test-project", Region: "us-central1"}}
+	e := echo.New()
+	agent, err := NewAgent(context.Background(), e, c, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(agent.Close)
+	return e, s
+}
+
+func ask(t *testing.T, e *echo.Echo, body string) (int, AskResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/ask", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var resp AskResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestOnAskGeneration(t *testing.T) {
+	e, _ := newTestAgent(t, fake.Rule{Response: "Visit the Colosseum."})
+	code, resp := ask(t, e, `{"message": "Plan 3 days in Rome", "temperature": 3, "top_p": 0, "max_output_tokens": 100000}`)
+	if code != http.StatusOK {
+		t.Fatalf("response = %d %+v", code, resp)
+	}
+	g := resp.Generation
+	if g == nil || g.Temperature == nil || *g.Temperature != 2 || g.TopP == nil || *g.TopP != 0.01 ||
+		g.MaxOutputTokens == nil || *g.MaxOutputTokens != 8192 || g.TopK != nil {
+		t.Errorf("generation = %+v, want temperature 2, top_p 0.01 and max_output_tokens 8192", g)
+	}
+	// the response without overrides echoes the configured parameters only
+	code, resp = ask(t, e, `{"session": "`+resp.SessionID+`", "message": "What about a day trip to Tivoli?"}`)
+	if code != http.StatusOK || resp.Generation != nil {
+		t.Errorf("response = %d %+v, want no generation parameters", code, resp)
+	}
+}
+
+func TestOnAskRefused(t *testing.T) {
+	e, s := newTestAgent(t, fake.Rule{Response: "Visit the Colosseum."})
+	code, first := ask(t, e, `{"message": "write me a Python web scraper"}`)
+	if code != http.StatusOK || first.FinishReason != llm.FinishReasonRefused {
+		t.Fatalf("first response = %d %+v, want refused", code, first)
+	}
+	code, second := ask(t, e, `{"session": "`+first.SessionID+`", "message": "Plan 3 days in Rome"}`)
+	if code != http.StatusOK || second.FinishReason != llm.FinishReasonStop {
+		t.Fatalf("second response = %d %+v", code, second)
+	}
+	// the refused exchange is not sent to the model
+	requests := s.Requests()
+	if len(requests) != 1 || requests[0].Turns != 1 {
+		t.Errorf("model requests = %+v, want one with 1 turn", requests)
+	}
+}
@@ -0,0 +1,107 @@
+package aiagent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+const (
+	attachmentsFormField = "files"
+	maxAttachments       = 4
+	// defaultMaxAttachmentSize keeps the request well below the 20MB limit of Gemini inline data
+	defaultMaxAttachmentSize = 4 << 20
+	// defaultMaxSessionAttachmentsSize keeps the chat history below the limit because it is sent with each message
+	defaultMaxSessionAttachmentsSize = 16 << 20
+	// defaultBodyLimit fits the maximal number of attachments and the form fields
+	defaultBodyLimit = maxAttachments*defaultMaxAttachmentSize + 1<<20
+)
+
+// attachmentTypes are the MIME types accepted by Gemini as they are detected by http.DetectContentType.
+var attachmentTypes = []string{"image/png", "image/jpeg", "image/webp", "application/pdf"}
+
+var (
+	errTooManyAttachments     = fmt.Errorf("no more than %d files can be attached", maxAttachments)
+	errAttachmentTooLarge     = errors.New("attached file is too large")
+	errSessionAttachmentsSize = errors.New("attached files exceed the size limit of the session")
+	errAttachmentMediaType    = fmt.Errorf("attached file is not one of %s", strings.Join(attachmentTypes, ", "))
+)
+
+// readAttachments returns the files uploaded with the multipart request.
+// The file type is detected from its content, so the type reported by the browser is ignored.
+func (a *Agent) readAttachments(ectx echo.Context) ([]llm.Blob, error) {
+	if !strings.HasPrefix(ectx.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return nil, nil
+	}
+	form, err := ectx.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("invalid multipart form: %w", err)
+	}
+	files := form.File[attachmentsFormField]
+	if len(files) > maxAttachments {
+		return nil, errTooManyAttachments
+	}
+	var blobs []llm.Blob
+	for _, f := range files {
+		if f.Size > a.maxAttachmentSize {
+			return nil, fmt.Errorf("%w: %q exceeds %d bytes", errAttachmentTooLarge, f.Filename, a.maxAttachmentSize)
+		}
+		data, err := readFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %w", f.Filename, err)
+		}
+		mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+		if !slices.Contains(attachmentTypes, mimeType) {
+			return nil, fmt.Errorf("%w: %q is %s", errAttachmentMediaType, f.Filename, mimeType)
+		}
+		blobs = append(blobs, llm.Blob{MIMEType: mimeType, Data: data})
+	}
+	return blobs, nil
+}
+
+// reserveAttachments adds the size of the blobs to the attachments of the session if it does not exceed
+// the limit. The returned function releases the size when the blobs are not kept in the chat history.
+func (a *Agent) reserveAttachments(s *ChatSession, blobs []llm.Blob) (release func(), err error) {
+	var size int64
+	for _, b := range blobs {
+		size += int64(len(b.Data))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s.attachmentsSize+size > a.maxSessionAttachmentsSize {
+		return nil, fmt.Errorf("%w: %d of %d bytes are used", errSessionAttachmentsSize, s.attachmentsSize, a.maxSessionAttachmentsSize)
+	}
+	s.attachmentsSize += size
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		s.attachmentsSize -= size
+	}, nil
+}
+
+func readFile(f *multipart.FileHeader) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func attachmentErrorCode(err error) int {
+	switch {
+	case errors.Is(err, errAttachmentTooLarge), errors.Is(err, errSessionAttachmentsSize):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errAttachmentMediaType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,118 @@
+package aiagent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minherz/aichallenges/challenge2/pkg/itinerary"
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/embedding"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+	"github.com/minherz/aichallenges/shared/utils"
+)
+
+// Config is the configuration of the service.
+// The generation parameters and the log level are applied without restart.
+type Config struct {
+	Server       config.Server      `yaml:"server"`
+	Model        config.Model       `yaml:"model"`
+	Generation   config.Generation  `yaml:"generation" hot:"true"`
+	Guardrails   config.Guardrails  `yaml:"guardrails"`
+	Embedding    config.Embedding   `yaml:"embedding"`
+	Instructions InstructionsConfig `yaml:"instructions"`
+	// ItineraryMaxAttempts is the number of attempts to generate a valid itinerary
+	ItineraryMaxAttempts int `yaml:"itinerary_max_attempts" env:"ITINERARY_MAX_ATTEMPTS"`
+	// AttachmentMaxSize and DocumentMaxSize are the size limits in bytes
+	AttachmentMaxSize int64 `yaml:"attachment_max_size" env:"ATTACHMENT_MAX_SIZE"`
+	DocumentMaxSize   int64 `yaml:"document_max_size" env:"DOCUMENT_MAX_SIZE"`
+	// SessionAttachmentsMaxSize is the size limit of all files attached in the session in bytes
+	SessionAttachmentsMaxSize int64 `yaml:"session_attachments_max_size" env:"SESSION_ATTACHMENTS_MAX_SIZE"`
+	// SessionTTL is the time after the last request when the session expires; 0 disables the expiration
+	SessionTTL time.Duration `yaml:"session_ttl" env:"SESSION_TTL"`
+	// AdminToken enables the admin API when it is set
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// InstructionsConfig defines where the system instructions are read from and how they are applied.
+type InstructionsConfig struct {
+	// Path is the root of the instructions files; the default instructions are used when it is empty
+	Path string `yaml:"path" env:"SYS_INSTRUCTION_PATH"`
+	// Watch is "auto", "events" or "polling"
+	Watch string `yaml:"watch" env:"SYS_INSTRUCTION_WATCH"`
+	// SessionPolicy is "latest" or "initial"
+	SessionPolicy string `yaml:"session_policy" env:"SESSION_INSTRUCTIONS"`
+}
+
+// DefaultConfig returns the configuration that is used when neither the configuration file
+// nor the environment variables set the values.
+// The embedding provider is empty to use Vertex AI with Vertex AI models and to disable documents otherwise.
+func DefaultConfig() *Config {
+	emb := config.DefaultEmbedding()
+	emb.Provider = ""
+	server := config.DefaultServer()
+	server.BodyLimit = defaultBodyLimit
+	return &Config{
+		Server:     server,
+		Model:      config.Model{Backend: llm.BackendGemini, Name: defaultModelName},
+		Generation: config.Generation{Limits: config.DefaultGenerationLimits()},
+		Guardrails: config.Guardrails{
+			Redactor:        guardrails.RedactorLocal,
+			InjectionAction: guardrails.InjectionActionBlock,
+			TopicGuard:      guardrails.TopicGuardKeywords,
+		},
+		Embedding: emb,
+		Instructions: InstructionsConfig{
+			Watch:         utils.WatchAuto,
+			SessionPolicy: sessionPolicyLatest,
+		},
+		ItineraryMaxAttempts: itinerary.DefaultMaxAttempts,
+		AttachmentMaxSize:    defaultMaxAttachmentSize,
+		DocumentMaxSize:      defaultMaxDocumentSize,
+		SessionTTL:           defaultSessionTTL,
+
+		SessionAttachmentsMaxSize: defaultMaxSessionAttachmentsSize,
+	}
+}
+
+func (c *Config) Validate() error {
+	errs := []error{c.Server.Validate(), c.Model.Validate(), c.Generation.Validate(), c.Guardrails.Validate(), c.Embedding.Validate()}
+	if _, err := parseSessionPolicy(c.Instructions.SessionPolicy); err != nil {
+		errs = append(errs, fmt.Errorf("instructions.session_policy: %w", err))
+	}
+	switch c.Instructions.Watch {
+	case utils.WatchAuto, utils.WatchEvents, utils.WatchPolling:
+	default:
+		errs = append(errs, fmt.Errorf("instructions.watch: unsupported watch mode %q", c.Instructions.Watch))
+	}
+	if c.ItineraryMaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("itinerary_max_attempts %d must be positive", c.ItineraryMaxAttempts))
+	}
+	if c.AttachmentMaxSize <= 0 || c.DocumentMaxSize <= 0 || c.SessionAttachmentsMaxSize <= 0 {
+		errs = append(errs, errors.New("attachment_max_size, document_max_size and session_attachments_max_size must be positive"))
+	}
+	if c.Server.BodyLimit < c.AttachmentMaxSize || c.Server.BodyLimit < c.DocumentMaxSize {
+		errs = append(errs, fmt.Errorf("server.body_limit %d must not be less than attachment_max_size and document_max_size", c.Server.BodyLimit))
+	}
+	if strings.EqualFold(c.Guardrails.TopicGuard, guardrails.TopicGuardEmbedding) && c.embeddingProvider() == embeddingProviderNone {
+		errs = append(errs, errors.New("guardrails.topic_guard embedding requires an embedding provider"))
+	}
+	if c.SessionTTL < 0 {
+		errs = append(errs, fmt.Errorf("session_ttl %v must not be negative", c.SessionTTL))
+	}
+	return errors.Join(errs...)
+}
+
+// embeddingProvider returns the configured embedding provider or the default for the model backend.
+func (c *Config) embeddingProvider() string {
+	if c.Embedding.Provider != "" {
+		return c.Embedding.Provider
+	}
+	if c.Model.Backend == llm.BackendOpenAI {
+		// self-hosted setups do not have to use Vertex AI for embeddings
+		return embeddingProviderNone
+	}
+	return embedding.ProviderVertex
+}
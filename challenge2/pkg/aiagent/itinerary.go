@@ -0,0 +1,167 @@
+package aiagent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/challenge2/pkg/itinerary"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+const startDateFormat = "2006-01-02"
+
+// ItineraryRequest asks for the itinerary of the trip in the message.
+// Without the message, the itinerary is generated from the chat session.
+type ItineraryRequest struct {
+	SessionID string `json:"session,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type ItineraryResponse struct {
+	BaseResponse
+	SessionID string               `json:"session,omitempty"`
+	Itinerary *itinerary.Itinerary `json:"itinerary,omitempty"`
+	// HTML is the rendered itinerary or the explanation why it was not generated
+	HTML string `json:"html,omitempty"`
+	// Message explains why the itinerary was not generated
+	Message      string           `json:"message,omitempty"`
+	FinishReason llm.FinishReason `json:"finish_reason,omitempty"`
+}
+
+// ExportRequest asks to export the itinerary or, if it is not set, the itinerary of the chat session.
+type ExportRequest struct {
+	SessionID string               `json:"session,omitempty" query:"session"`
+	Itinerary *itinerary.Itinerary `json:"itinerary,omitempty"`
+	// Format is "ics" or "gpx"
+	Format string `json:"format,omitempty" query:"format"`
+	// StartDate is the first day of the trip in YYYY-MM-DD format. Defaults to tomorrow.
+	StartDate string `json:"start,omitempty" query:"start"`
+}
+
+func (a *Agent) onItinerary(ectx echo.Context) error {
+	r := &ItineraryRequest{}
+	if err := ectx.Bind(r); err != nil {
+		return reportItineraryError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
+	}
+	if r.Message == "" && r.SessionID == "" {
+		return reportItineraryError(ectx, http.StatusBadRequest, fmt.Errorf("request message and session are empty"))
+	}
+	it, response, err := a.sessionItinerary(ectx, r.SessionID, r.Message)
+	if err != nil {
+		return reportItineraryError(ectx, itineraryErrorCode(err), err)
+	}
+	if it == nil {
+		f := guardrails.FormatModelResponse(response)
+		return ectx.JSON(http.StatusOK, ItineraryResponse{SessionID: r.SessionID, Message: f.Text, HTML: f.HTML, FinishReason: response.FinishReason})
+	}
+	html, err := it.HTML()
+	if err != nil {
+		return reportItineraryError(ectx, http.StatusInternalServerError, err)
+	}
+	slog.Debug("itinerary request processed", "session", r.SessionID, "days", len(it.Days))
+	return ectx.JSON(http.StatusOK, ItineraryResponse{SessionID: r.SessionID, Itinerary: it, HTML: html, FinishReason: response.FinishReason})
+}
+
+// sessionItinerary generates the itinerary from the message or, if the message is empty, from the chat session.
+// The itinerary is stored in the session if it exists.
+func (a *Agent) sessionItinerary(ectx echo.Context, id, message string) (*itinerary.Itinerary, *llm.Response, error) {
+	ctx := llm.ContextWithSession(ectx.Request().Context(), id)
+	s, found := a.getSession(id)
+	var (
+		it       *itinerary.Itinerary
+		response *llm.Response
+		err      error
+	)
+	if message != "" {
+		it, response, err = a.itineraries.Generate(ctx, message)
+	} else {
+		if !found || len(s.chat.History()) == 0 {
+			return nil, nil, fmt.Errorf("%w: %q", errSessionNotFound, id)
+		}
+		it, response, err = a.itineraries.FromConversation(ctx, s.chat.History())
+	}
+	if err != nil || it == nil || !found {
+		return it, response, err
+	}
+	a.mu.Lock()
+	s.itinerary = it
+	a.mu.Unlock()
+	return it, response, nil
+}
+
+var errSessionNotFound = errors.New("chat session is not found or has no messages")
+
+func (a *Agent) onExport(ectx echo.Context) error {
+	r := &ExportRequest{}
+	if err := ectx.Bind(r); err != nil {
+		return reportItineraryError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
+	}
+	contentType, err := itinerary.ContentType(r.Format)
+	if err != nil {
+		return reportItineraryError(ectx, http.StatusBadRequest, err)
+	}
+	start := time.Now().AddDate(0, 0, 1)
+	if r.StartDate != "" {
+		if start, err = time.Parse(startDateFormat, r.StartDate); err != nil {
+			return reportItineraryError(ectx, http.StatusBadRequest, fmt.Errorf("invalid start date: %w", err))
+		}
+	}
+	it := r.Itinerary
+	if it != nil {
+		if err := it.Validate(); err != nil {
+			return reportItineraryError(ectx, http.StatusBadRequest, err)
+		}
+	} else {
+		if r.SessionID == "" {
+			return reportItineraryError(ectx, http.StatusBadRequest, fmt.Errorf("request itinerary and session are empty"))
+		}
+		if s, ok := a.getSession(r.SessionID); ok {
+			a.mu.Lock()
+			it = s.itinerary
+			a.mu.Unlock()
+		}
+		if it == nil {
+			var response *llm.Response
+			if it, response, err = a.sessionItinerary(ectx, r.SessionID, ""); err != nil {
+				return reportItineraryError(ectx, itineraryErrorCode(err), err)
+			}
+			if it == nil {
+				return reportItineraryError(ectx, http.StatusUnprocessableEntity,
+					fmt.Errorf("cannot create itinerary: %s", guardrails.FormatModelResponse(response).Text))
+			}
+		}
+	}
+	data, err := it.Export(r.Format, start)
+	if err != nil {
+		if errors.Is(err, itinerary.ErrNoCoordinates) {
+			return reportItineraryError(ectx, http.StatusUnprocessableEntity, err)
+		}
+		return reportItineraryError(ectx, http.StatusInternalServerError, err)
+	}
+	ectx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "itinerary."+r.Format))
+	return ectx.Blob(http.StatusOK, contentType, data)
+}
+
+func itineraryErrorCode(err error) int {
+	switch {
+	case errors.Is(err, guardrails.ErrPromptInjection):
+		return http.StatusBadRequest
+	case errors.Is(err, errSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, itinerary.ErrInvalid):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func reportItineraryError(ectx echo.Context, code int, err error) error {
+	msg := err.Error()
+	slog.Error(msg, "response_code", code)
+	return ectx.JSON(code, ItineraryResponse{BaseResponse: BaseResponse{Error: msg}})
+}
@@ -0,0 +1,90 @@
+package aiagent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/minherz/aichallenges/challenge2/pkg/instructions"
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Policies of the chat sessions when the system instructions change.
+const (
+	// sessionPolicyLatest uses the active configuration for each message of the session
+	sessionPolicyLatest = "latest"
+	// sessionPolicyInitial keeps the configuration that was active when the session was created
+	sessionPolicyInitial = "initial"
+)
+
+// modelConfig is the configuration of the model requests. It is never modified after it is published.
+// Changes create a new snapshot that replaces the old one atomically, so concurrent requests
+// never see the instructions of one version combined with the settings of another.
+type modelConfig struct {
+	instructions *instructions.Version
+	// personas are the instructions of the named assistants that replace the default instructions
+	personas map[string]*instructions.Version
+	// generation holds the parameters of the requests and the limits of their overrides
+	generation config.Generation
+	safety     []llm.SafetySetting
+}
+
+// instructionsFor returns the instructions of the persona or the default instructions if persona is empty.
+func (c *modelConfig) instructionsFor(persona string) (*instructions.Version, error) {
+	if persona == "" {
+		return c.instructions, nil
+	}
+	v, ok := c.personas[persona]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", instructions.ErrUnknownPersona, persona)
+	}
+	return v, nil
+}
+
+// apply sets the system instructions of the persona and the parameters of the request
+// overridden by the parameters p of the user request.
+// It returns the version of the instructions. The system instructions can be augmented
+// with the session documents later.
+func (c *modelConfig) apply(req *llm.Request, persona string, p config.GenerationParameters) (*instructions.Version, error) {
+	v, err := c.instructionsFor(persona)
+	if err != nil {
+		return nil, err
+	}
+	req.SystemInstruction = v.Text
+	req.Config = c.generation.Limits.Override(c.generation.LLMConfig(), p)
+	req.SafetySettings = c.safety
+	return v, nil
+}
+
+// updateConfig replaces the configuration snapshot with the copy changed by fn.
+// It retries if another goroutine replaced the snapshot concurrently, so no change is lost.
+func (a *Agent) updateConfig(fn func(c *modelConfig)) {
+	for {
+		old := a.config.Load()
+		c := &modelConfig{}
+		if old != nil {
+			*c = *old
+		}
+		fn(c)
+		if a.config.CompareAndSwap(old, c) {
+			return
+		}
+	}
+}
+
+// sessionConfig returns the configuration for the next message of the session according to the session policy.
+func (a *Agent) sessionConfig(s *ChatSession) *modelConfig {
+	if a.sessionPolicy == sessionPolicyInitial {
+		return s.config
+	}
+	return a.config.Load()
+}
+
+func parseSessionPolicy(policy string) (string, error) {
+	switch p := strings.ToLower(policy); p {
+	case sessionPolicyLatest, sessionPolicyInitial:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unsupported session policy %q", policy)
+	}
+}
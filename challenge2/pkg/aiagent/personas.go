@@ -0,0 +1,78 @@
+package aiagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/challenge2/pkg/instructions"
+)
+
+var errPersonaChanged = errors.New("persona cannot be changed in the session")
+
+// Persona is the named assistant that uses its own system instructions.
+type Persona struct {
+	Name string `json:"name"`
+	// Version is the ID of the persona instructions
+	Version string `json:"version"`
+}
+
+type PersonasResponse struct {
+	BaseResponse
+	Personas []Persona `json:"personas"`
+}
+
+func (a *Agent) onPersonas(ectx echo.Context) error {
+	personas := []Persona{}
+	for _, v := range instructions.SortedPersonas(a.config.Load().personas) {
+		personas = append(personas, Persona{Name: v.Name, Version: v.ID})
+	}
+	return ectx.JSON(http.StatusOK, PersonasResponse{Personas: personas})
+}
+
+// claimPersona returns the persona of the session or, if the session has none yet, the requested persona.
+// Later messages can omit the persona but cannot change it. Until the first exchange succeeds the persona is
+// claimed, so concurrent first messages cannot start the session with different personas.
+// The returned done func must be called with the result of the exchange; the successful one binds the persona.
+func (a *Agent) claimPersona(s *ChatSession, persona string) (string, func(ok bool), error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s.personaBound {
+		if persona != "" && persona != s.persona {
+			return "", nil, fmt.Errorf("%w: the session uses %q", errPersonaChanged, s.persona)
+		}
+		return s.persona, func(bool) {}, nil
+	}
+	if s.personaClaims > 0 {
+		if persona != "" && persona != s.claimedPersona {
+			return "", nil, fmt.Errorf("%w: the session is starting with %q", errPersonaChanged, s.claimedPersona)
+		}
+		persona = s.claimedPersona
+	}
+	s.claimedPersona = persona
+	s.personaClaims++
+	done := func(ok bool) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		s.personaClaims--
+		if ok && !s.personaBound {
+			s.persona, s.personaBound = persona, true
+		}
+		if s.personaClaims == 0 {
+			s.claimedPersona = ""
+		}
+	}
+	return persona, done, nil
+}
+
+func personaErrorCode(err error) int {
+	switch {
+	case errors.Is(err, instructions.ErrUnknownPersona):
+		return http.StatusBadRequest
+	case errors.Is(err, errPersonaChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,101 @@
+package aiagent
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClaimPersona(t *testing.T) {
+	a := &Agent{}
+	s := &ChatSession{}
+
+	// the first messages are in progress
+	persona, done1, err := a.claimPersona(s, "business")
+	if err != nil || persona != "business" {
+		t.Fatalf("claimPersona(business) = %q, %v", persona, err)
+	}
+	if _, _, err := a.claimPersona(s, "family"); !errors.Is(err, errPersonaChanged) {
+		t.Errorf("concurrent claimPersona(family) error = %v, want %v", err, errPersonaChanged)
+	}
+	persona, done2, err := a.claimPersona(s, "")
+	if err != nil || persona != "business" {
+		t.Fatalf("concurrent claimPersona(\"\") = %q, %v, want business", persona, err)
+	}
+
+	// the failed exchange does not bind the persona
+	done1(false)
+	if s.personaBound {
+		t.Fatal("persona is bound after the failed exchange")
+	}
+	done2(true)
+	if !s.personaBound || s.persona != "business" {
+		t.Fatalf("bound persona = %q, %v, want business", s.persona, s.personaBound)
+	}
+
+	persona, done, err := a.claimPersona(s, "")
+	if err != nil || persona != "business" {
+		t.Errorf("claimPersona(\"\") = %q, %v, want business", persona, err)
+	}
+	done(true)
+	if _, _, err := a.claimPersona(s, "family"); !errors.Is(err, errPersonaChanged) {
+		t.Errorf("claimPersona(family) error = %v, want %v", err, errPersonaChanged)
+	}
+}
+
+func TestClaimPersonaReleased(t *testing.T) {
+	a := &Agent{}
+	s := &ChatSession{}
+	_, done, err := a.claimPersona(s, "business")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(false)
+	// the session can start with another persona after the first message failed
+	persona, done, err := a.claimPersona(s, "family")
+	if err != nil || persona != "family" {
+		t.Fatalf("claimPersona(family) = %q, %v", persona, err)
+	}
+	done(true)
+	if s.persona != "family" {
+		t.Errorf("bound persona = %q, want family", s.persona)
+	}
+}
+
+func TestClaimPersonaConcurrent(t *testing.T) {
+	a := &Agent{}
+	s := &ChatSession{}
+	personas := []string{"business", "family", "business", "family", "solo", ""}
+	type result struct {
+		persona string
+		done    func(bool)
+	}
+	results := make(chan result, len(personas))
+	for _, p := range personas {
+		go func() {
+			persona, done, err := a.claimPersona(s, p)
+			if err != nil {
+				results <- result{}
+				return
+			}
+			results <- result{persona, done}
+		}()
+	}
+	claimed := map[string]bool{}
+	var dones []func(bool)
+	for range personas {
+		r := <-results
+		if r.done != nil {
+			claimed[r.persona] = true
+			dones = append(dones, r.done)
+		}
+	}
+	if len(claimed) != 1 {
+		t.Errorf("concurrent first messages claimed personas %v, want one", claimed)
+	}
+	for _, done := range dones {
+		done(true)
+	}
+	if !claimed[s.persona] {
+		t.Errorf("bound persona %q is not the claimed one %v", s.persona, claimed)
+	}
+}
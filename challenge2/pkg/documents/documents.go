@@ -0,0 +1,179 @@
+// Package documents keeps the documents uploaded by the user in memory
+// and finds the parts of them that are relevant to the user message.
+package documents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/minherz/aichallenges/shared/embedding"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunk in bytes
+	DefaultChunkSize = 1000
+	// DefaultChunkOverlap is the number of bytes that consecutive chunks share,
+	// so the sentences on the chunk boundary are not lost
+	DefaultChunkOverlap = 200
+)
+
+// ErrTooManyChunks is returned when the document does not fit in the index.
+var ErrTooManyChunks = errors.New("documents exceed the chunk limit")
+
+// Chunk is the part of the document that is embedded and retrieved as a whole.
+type Chunk struct {
+	Document string
+	Text     string
+}
+
+// Split splits the text into chunks of up to size bytes that overlap by up to overlap bytes.
+// Chunks end on word boundaries unless a single word is longer than size.
+func Split(text string, size, overlap int) []string {
+	words := strings.Fields(text)
+	var chunks []string
+	for start := 0; start < len(words); {
+		end, n := start, 0
+		for end < len(words) && (end == start || n+len(words[end])+1 <= size) {
+			n += len(words[end]) + 1
+			end++
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+		// step back to repeat the last words of the chunk at the start of the next one
+		next, m := end, 0
+		for next > start+1 && m+len(words[next-1])+1 <= overlap {
+			next--
+			m += len(words[next]) + 1
+		}
+		start = next
+	}
+	return chunks
+}
+
+// Index is an in-memory vector index of the document chunks.
+type Index struct {
+	embedder embedding.Embedder
+	// limit is the maximal number of chunks; zero means no limit
+	limit   int
+	mu      sync.Mutex
+	chunks  []Chunk
+	vectors [][]float32
+}
+
+// NewIndex returns the index that holds up to limit chunks. Zero limit means no limit.
+func NewIndex(embedder embedding.Embedder, limit int) *Index {
+	return &Index{embedder: embedder, limit: limit}
+}
+
+// Add embeds the chunks of the document and adds them to the index.
+// The chunks replace the chunks of the previously added document with the same name.
+// Nothing is added if any of the chunks cannot be embedded or if the index would exceed its limit.
+func (x *Index) Add(ctx context.Context, document string, chunks []string) error {
+	// fail fast before embedding; the limit is checked again when the chunks are added
+	x.mu.Lock()
+	err := x.checkLimit(document, len(chunks))
+	x.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	vectors := make([][]float32, 0, len(chunks))
+	for i, c := range chunks {
+		v, err := x.embedder.EmbedDocument(ctx, c)
+		if err != nil {
+			return fmt.Errorf("cannot embed chunk %d of %q: %w", i+1, document, err)
+		}
+		vectors = append(vectors, v)
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.checkLimit(document, len(chunks)); err != nil {
+		return err
+	}
+	n := 0
+	for i, c := range x.chunks {
+		if c.Document != document {
+			x.chunks[n], x.vectors[n] = c, x.vectors[i]
+			n++
+		}
+	}
+	x.chunks, x.vectors = x.chunks[:n], x.vectors[:n]
+	for _, c := range chunks {
+		x.chunks = append(x.chunks, Chunk{Document: document, Text: c})
+	}
+	x.vectors = append(x.vectors, vectors...)
+	return nil
+}
+
+// checkLimit returns ErrTooManyChunks if n chunks of the document do not fit in the index.
+// The chunks of the document with the same name are not counted because they are replaced.
+// It must be called with x.mu held.
+func (x *Index) checkLimit(document string, n int) error {
+	if x.limit == 0 {
+		return nil
+	}
+	for _, c := range x.chunks {
+		if c.Document != document {
+			n++
+		}
+	}
+	if n > x.limit {
+		return fmt.Errorf("%w: %q needs %d of %d chunks", ErrTooManyChunks, document, n, x.limit)
+	}
+	return nil
+}
+
+// Len returns the number of chunks in the index.
+func (x *Index) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.chunks)
+}
+
+// Documents returns the names of the indexed documents in the order they were added.
+// A replaced document is listed once at the position of its last upload.
+func (x *Index) Documents() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var names []string
+	for _, c := range x.chunks {
+		if len(names) == 0 || names[len(names)-1] != c.Document {
+			names = append(names, c.Document)
+		}
+	}
+	return names
+}
+
+// Search returns up to k chunks that are the most similar to the query.
+func (x *Index) Search(ctx context.Context, query string, k int) ([]Chunk, error) {
+	if x.Len() == 0 {
+		return nil, nil
+	}
+	vector, err := x.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	type match struct {
+		pos        int
+		similarity float64
+	}
+	matches := make([]match, 0, len(x.vectors))
+	for i, v := range x.vectors {
+		matches = append(matches, match{pos: i, similarity: embedding.CosineSimilarity(v, vector)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].similarity > matches[j].similarity
+	})
+	chunks := make([]Chunk, 0, k)
+	for i := 0; i < len(matches) && i < k; i++ {
+		chunks = append(chunks, x.chunks[matches[i].pos])
+	}
+	return chunks, nil
+}
@@ -0,0 +1,334 @@
+// Package instructions tracks versions of the system instructions that are loaded from files,
+// so the service knows which version is active and can pin or roll back to another one.
+package instructions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CurrentFile is the path of the active instructions relative to the root directory
+	CurrentFile = "current/system_instructions.txt"
+	// VersionsDir is the directory relative to the root that keeps previous versions as <name>.txt files
+	VersionsDir = "versions"
+	// SourceDefault is the source of the instructions that are built into the service
+	SourceDefault = "default"
+
+	maxHistory = 100
+)
+
+// Actions recorded in the history.
+const (
+	ActionLoad     = "load"
+	ActionReload   = "reload"
+	ActionIgnore   = "ignore"
+	ActionActivate = "activate"
+	ActionPin      = "pin"
+	ActionUnpin    = "unpin"
+)
+
+// ErrNotFound is returned when the requested version is neither loaded nor stored in the versions directory.
+var ErrNotFound = errors.New("instructions version is not found")
+
+// ErrStale is returned when the change of the current instructions file is not applied.
+var ErrStale = errors.New("system instructions are stale")
+
+// Version is the immutable system instructions with the information where they come from.
+type Version struct {
+	// ID is the prefix of SHA-256 hash of the text
+	ID string `json:"id"`
+	// Name is the file name without extension for the versions in VersionsDir
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source"`
+	// LoadedAt is the time when the version was loaded by the service; nil for the versions that were never loaded
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	Text     string     `json:"-"`
+}
+
+// Event is the audit record of the change of the active version.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Version string    `json:"version"`
+	Source  string    `json:"source"`
+	// Actor identifies who requested the change; empty for the changes made by the service
+	Actor string `json:"actor,omitempty"`
+}
+
+// Store keeps the active version of the instructions and the versions loaded since the start.
+type Store struct {
+	root    string
+	mu      sync.RWMutex
+	current *Version
+	pinned  bool
+	loaded  map[string]*Version
+	history []Event
+	// listeners are called under the lock after each activation
+	listeners []func(*Version)
+}
+
+// NewStore loads the instructions from CurrentFile in root.
+// The defaultText is used when root is empty or the file cannot be read.
+func NewStore(root, defaultText string) *Store {
+	s := &Store{root: root, loaded: make(map[string]*Version)}
+	if root != "" {
+		v, err := readVersion(s.Path())
+		if err == nil {
+			s.activate(v, ActionLoad, "")
+			return s
+		}
+		slog.Error("failed to read system instructions", "error", err, "path", s.Path())
+	}
+	s.activate(newVersion(defaultText, SourceDefault), ActionLoad, "")
+	return s
+}
+
+// Path returns the path of the current instructions file or an empty string if root is not set.
+func (s *Store) Path() string {
+	if s.root == "" {
+		return ""
+	}
+	return filepath.Join(s.root, CurrentFile)
+}
+
+// Current returns the active version.
+func (s *Store) Current() *Version {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Pinned reports whether the changes of the current instructions file are ignored.
+func (s *Store) Pinned() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pinned
+}
+
+// OnActivate calls fn with the current version and then with each activated version.
+// The calls are serialized, so fn always sees the versions in the order of activation.
+// fn is called while the store is locked and must not call the store methods.
+func (s *Store) OnActivate(fn func(*Version)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.current)
+	s.listeners = append(s.listeners, fn)
+}
+
+// History returns the audit records from the oldest to the newest.
+func (s *Store) History() []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.history)
+}
+
+// Reload reads the changed instructions file. It is the callback of the file watcher.
+// The change is recorded but not applied when the version is pinned.
+func (s *Store) Reload(path string) {
+	v, err := readVersion(path)
+	if err != nil {
+		slog.Error("failed to read system instructions", "error", err, "path", path)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v.ID == s.current.ID {
+		return
+	}
+	if s.pinned {
+		if last := s.history[len(s.history)-1]; last.Action == ActionIgnore && last.Version == v.ID {
+			return
+		}
+		s.loaded[v.ID] = loaded(v)
+		s.record(v, ActionIgnore, "")
+		slog.Warn("system instructions are pinned, the change is ignored", "version", v.ID, "pinned_version", s.current.ID)
+		return
+	}
+	s.activate(v, ActionReload, "")
+}
+
+// Fresh returns an error if the current instructions file cannot be read or if it was changed
+// more than grace ago and the change is still not active. Pinned versions are always fresh.
+func (s *Store) Fresh(grace time.Duration) error {
+	path := s.Path()
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot access system instructions: %w", err)
+	}
+	v, err := readVersion(path)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pinned || v.ID == s.current.ID || time.Since(fi.ModTime()) < grace {
+		return nil
+	}
+	return fmt.Errorf("%w: version %s of %s changed at %s is not active", ErrStale, v.ID, path, fi.ModTime().Format(time.RFC3339))
+}
+
+// Versions returns the versions loaded since the start and the versions stored in VersionsDir.
+func (s *Store) Versions() ([]*Version, error) {
+	s.mu.RLock()
+	versions := make([]*Version, 0, len(s.loaded))
+	seen := make(map[string]bool, len(s.loaded))
+	for _, v := range s.loaded {
+		versions = append(versions, v)
+		seen[v.ID+"/"+v.Name] = true
+	}
+	s.mu.RUnlock()
+	stored, err := s.storedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range stored {
+		if !seen[v.ID+"/"+v.Name] {
+			versions = append(versions, v)
+		}
+	}
+	// loaded versions go first in the order they were loaded
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i].LoadedAt, versions[j].LoadedAt
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.Before(*b)
+	})
+	return versions, nil
+}
+
+// Activate makes the version with the ID or the name active. If pin is true, the changes
+// of the current instructions file are ignored until Unpin is called.
+func (s *Store) Activate(id string, pin bool, actor string) (*Version, error) {
+	v, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinned = pin
+	action := ActionActivate
+	if pin {
+		action = ActionPin
+	}
+	s.activate(v, action, actor)
+	return s.current, nil
+}
+
+// Unpin resumes following the current instructions file and reloads it.
+func (s *Store) Unpin(actor string) (*Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinned = false
+	v := s.current
+	if path := s.Path(); path != "" {
+		var err error
+		if v, err = readVersion(path); err != nil {
+			s.record(s.current, ActionUnpin, actor)
+			return nil, err
+		}
+	}
+	s.activate(v, ActionUnpin, actor)
+	return s.current, nil
+}
+
+func (s *Store) find(id string) (*Version, error) {
+	s.mu.RLock()
+	v, ok := s.loaded[id]
+	s.mu.RUnlock()
+	if ok {
+		return v, nil
+	}
+	stored, err := s.storedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range stored {
+		if v.ID == id || v.Name == id {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+}
+
+// storedVersions reads the versions in VersionsDir.
+func (s *Store) storedVersions() ([]*Version, error) {
+	if s.root == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(s.root, VersionsDir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	var versions []*Version
+	for _, path := range paths {
+		v, err := readVersion(path)
+		if err != nil {
+			return nil, err
+		}
+		v.Name = strings.TrimSuffix(filepath.Base(path), ".txt")
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// activate sets the current version and records the action. The caller must hold the lock.
+func (s *Store) activate(v *Version, action, actor string) {
+	v = loaded(v)
+	s.current = v
+	s.loaded[v.ID] = v
+	s.record(v, action, actor)
+	for _, fn := range s.listeners {
+		fn(v)
+	}
+	slog.Info("system instructions are activated", "version", v.ID, "source", v.Source, "action", action, "actor", actor, "pinned", s.pinned)
+	slog.Debug("system instructions have been set", "version", v.ID, "instructions", v.Text)
+}
+
+func (s *Store) record(v *Version, action, actor string) {
+	s.history = append(s.history, Event{Time: time.Now(), Action: action, Version: v.ID, Source: v.Source, Actor: actor})
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+}
+
+func readVersion(path string) (*Version, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(text)) == "" {
+		return nil, fmt.Errorf("system instructions in %s are empty", path)
+	}
+	return newVersion(string(text), path), nil
+}
+
+func newVersion(text, source string) *Version {
+	h := sha256.Sum256([]byte(text))
+	return &Version{ID: hex.EncodeToString(h[:6]), Source: source, Text: text}
+}
+
+// loaded returns the copy of the version with the load time if it was not loaded before.
+func loaded(v *Version) *Version {
+	if v.LoadedAt != nil {
+		return v
+	}
+	c := *v
+	now := time.Now()
+	c.LoadedAt = &now
+	return &c
+}
@@ -0,0 +1,306 @@
+package instructions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const defaultText = "You are a travel assistant."
+
+// newTestStore creates the store in a temporary root with the current instructions and the stored versions.
+func newTestStore(t *testing.T, current string, versions map[string]string) (*Store, string) {
+	t.Helper()
+	root := t.TempDir()
+	writeInstructions(t, filepath.Join(root, CurrentFile), current)
+	for name, text := range versions {
+		writeInstructions(t, filepath.Join(root, VersionsDir, name+".txt"), text)
+	}
+	return NewStore(root, defaultText), root
+}
+
+func writeInstructions(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func actions(events []Event) []string {
+	var list []string
+	for _, e := range events {
+		list = append(list, e.Action+":"+e.Version)
+	}
+	return list
+}
+
+func TestNewStore(t *testing.T) {
+	s := NewStore("", defaultText)
+	if v := s.Current(); v.Text != defaultText || v.Source != SourceDefault || v.LoadedAt == nil {
+		t.Errorf("Current() = %+v, want the default instructions", v)
+	}
+	if s.Path() != "" {
+		t.Errorf("Path() = %q, want empty", s.Path())
+	}
+
+	s, root := newTestStore(t, "v1", nil)
+	path := filepath.Join(root, CurrentFile)
+	if v := s.Current(); v.Text != "v1" || v.Source != path {
+		t.Errorf("Current() = %+v, want the current file", v)
+	}
+
+	// the default instructions are used when the file cannot be read
+	s = NewStore(t.TempDir(), defaultText)
+	if v := s.Current(); v.Source != SourceDefault {
+		t.Errorf("Current() = %+v, want the default instructions", v)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	s, root := newTestStore(t, "v1", nil)
+	path := filepath.Join(root, CurrentFile)
+	var activated []string
+	s.OnActivate(func(v *Version) { activated = append(activated, v.Text) })
+	v1 := s.Current()
+
+	writeInstructions(t, path, "v2")
+	s.Reload(path)
+	v2 := s.Current()
+	if v2.Text != "v2" || v2.ID == v1.ID {
+		t.Errorf("Current() = %+v, want v2", v2)
+	}
+	// the same text is not activated again
+	s.Reload(path)
+	// the empty file is not applied
+	writeInstructions(t, path, " \n")
+	s.Reload(path)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	s.Reload(path)
+	if s.Current() != v2 {
+		t.Errorf("Current() = %+v, want v2", s.Current())
+	}
+	if want := []string{"v1", "v2"}; fmt.Sprint(activated) != fmt.Sprint(want) {
+		t.Errorf("activated %v, want %v", activated, want)
+	}
+	if got, want := actions(s.History()), []string{ActionLoad + ":" + v1.ID, ActionReload + ":" + v2.ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("History() = %v, want %v", got, want)
+	}
+}
+
+func TestStoreActivate(t *testing.T) {
+	s, root := newTestStore(t, "v1", map[string]string{"summer": "summer text", "winter": "winter text"})
+	path := filepath.Join(root, CurrentFile)
+	v1 := s.Current()
+
+	summer, err := s.Activate("summer", false, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summer.Text != "summer text" || summer.Name != "summer" || summer.LoadedAt == nil || s.Pinned() {
+		t.Errorf("Activate(summer) = %+v, pinned %v", summer, s.Pinned())
+	}
+	// the version is activated by its ID
+	if v, err := s.Activate(v1.ID, false, "alice"); err != nil || v.ID != v1.ID {
+		t.Errorf("Activate(%s) = %+v, %v", v1.ID, v, err)
+	}
+	// the stored version that was never loaded is found by its ID
+	winterID := newVersion("winter text", "").ID
+	if v, err := s.Activate(winterID, false, "bob"); err != nil || v.Name != "winter" {
+		t.Errorf("Activate(%s) = %+v, %v", winterID, v, err)
+	}
+	if _, err := s.Activate("spring", false, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Activate(spring) error = %v, want %v", err, ErrNotFound)
+	}
+
+	// the not pinned version is replaced by the change of the current file
+	writeInstructions(t, path, "v2")
+	s.Reload(path)
+	if s.Current().Text != "v2" {
+		t.Errorf("Current() = %+v, want v2", s.Current())
+	}
+	history := s.History()
+	if history[1].Actor != "alice" || history[1].Action != ActionActivate {
+		t.Errorf("History()[1] = %+v, want activation by alice", history[1])
+	}
+}
+
+func TestStorePinAndUnpin(t *testing.T) {
+	s, root := newTestStore(t, "v1", map[string]string{"summer": "summer text"})
+	path := filepath.Join(root, CurrentFile)
+	summer, err := s.Activate("summer", true, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Pinned() {
+		t.Fatal("Pinned() = false after the pin")
+	}
+	writeInstructions(t, path, "v2")
+	s.Reload(path)
+	// the repeated events of the same change are recorded once
+	s.Reload(path)
+	if s.Current().ID != summer.ID {
+		t.Errorf("Current() = %+v, want pinned summer", s.Current())
+	}
+	if err := s.Fresh(time.Nanosecond); err != nil {
+		t.Errorf("Fresh() of the pinned version = %v", err)
+	}
+
+	v, err := s.Unpin("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Text != "v2" || s.Pinned() {
+		t.Errorf("Unpin() = %+v, pinned %v, want v2", v, s.Pinned())
+	}
+	v2 := newVersion("v2", "").ID
+	want := []string{
+		ActionLoad + ":" + newVersion("v1", "").ID,
+		ActionPin + ":" + summer.ID,
+		ActionIgnore + ":" + v2,
+		ActionUnpin + ":" + v2,
+	}
+	if got := actions(s.History()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("History() = %v, want %v", got, want)
+	}
+	// the ignored change is listed as a loaded version
+	versions, err := s.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, v := range versions {
+		found = found || v.ID == v2 && v.LoadedAt != nil
+	}
+	if !found {
+		t.Errorf("Versions() does not list the ignored version %s", v2)
+	}
+}
+
+func TestStoreUnpinError(t *testing.T) {
+	s, root := newTestStore(t, "v1", map[string]string{"summer": "summer text"})
+	if _, err := s.Activate("summer", true, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, CurrentFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Unpin("bob"); err == nil {
+		t.Fatal("Unpin() without the current file succeeded")
+	}
+	// the store follows the file again when it appears
+	if s.Pinned() || s.Current().Name != "summer" {
+		t.Errorf("Current() = %+v, pinned %v", s.Current(), s.Pinned())
+	}
+	history := s.History()
+	if last := history[len(history)-1]; last.Action != ActionUnpin || last.Actor != "bob" {
+		t.Errorf("last event = %+v, want unpin by bob", last)
+	}
+}
+
+func TestStoreVersions(t *testing.T) {
+	s, root := newTestStore(t, "v1", map[string]string{"summer": "summer text", "winter": "winter text", "same": "v1"})
+	path := filepath.Join(root, CurrentFile)
+	time.Sleep(time.Millisecond)
+	writeInstructions(t, path, "v2")
+	s.Reload(path)
+
+	versions, err := s.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.Text+"/"+v.Name+"/"+fmt.Sprint(v.LoadedAt != nil))
+	}
+	// loaded versions go first in the load order; the stored version with the text of the loaded one is listed by its name
+	want := []string{"v1//true", "v2//true", "summer text/summer/false", "v1/same/false", "winter text/winter/false"}
+	if len(got) != len(want) || fmt.Sprint(got[:2]) != fmt.Sprint(want[:2]) {
+		t.Fatalf("Versions() = %v, want %v", got, want)
+	}
+	stored := map[string]bool{}
+	for _, v := range got[2:] {
+		stored[v] = true
+	}
+	for _, v := range want[2:] {
+		if !stored[v] {
+			t.Errorf("Versions() = %v, want to contain %q", got, v)
+		}
+	}
+
+	// the activated stored version is listed once
+	if _, err := s.Activate("summer", false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err = s.Versions(); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(want) {
+		t.Errorf("Versions() returned %d versions, want %d", len(versions), len(want))
+	}
+}
+
+func TestStoreFresh(t *testing.T) {
+	if err := NewStore("", defaultText).Fresh(time.Second); err != nil {
+		t.Errorf("Fresh() of the default instructions = %v", err)
+	}
+	s, root := newTestStore(t, "v1", nil)
+	path := filepath.Join(root, CurrentFile)
+	if err := s.Fresh(time.Second); err != nil {
+		t.Errorf("Fresh() = %v", err)
+	}
+	writeInstructions(t, path, "v2")
+	// the change is in the grace period
+	if err := s.Fresh(time.Hour); err != nil {
+		t.Errorf("Fresh() in the grace period = %v", err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Fresh(time.Second); !errors.Is(err, ErrStale) {
+		t.Errorf("Fresh() = %v, want %v", err, ErrStale)
+	}
+	s.Reload(path)
+	if err := s.Fresh(time.Second); err != nil {
+		t.Errorf("Fresh() after reload = %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Fresh(time.Second); err == nil || errors.Is(err, ErrStale) {
+		t.Errorf("Fresh() without the file = %v, want the access error", err)
+	}
+}
+
+func TestStoreHistoryLimit(t *testing.T) {
+	s, root := newTestStore(t, "v0", nil)
+	path := filepath.Join(root, CurrentFile)
+	for i := 1; i <= maxHistory+20; i++ {
+		writeInstructions(t, path, fmt.Sprintf("v%d", i))
+		s.Reload(path)
+	}
+	history := s.History()
+	if len(history) != maxHistory {
+		t.Fatalf("History() has %d events, want %d", len(history), maxHistory)
+	}
+	// the oldest events are dropped
+	if first, want := history[0].Version, newVersion("v21", "").ID; first != want {
+		t.Errorf("first event version = %s, want %s", first, want)
+	}
+	if last, want := history[maxHistory-1].Version, s.Current().ID; last != want {
+		t.Errorf("last event version = %s, want %s", last, want)
+	}
+	// the returned history is a copy
+	history[0].Action = "changed"
+	if s.History()[0].Action == "changed" {
+		t.Error("History() returns the internal slice")
+	}
+}
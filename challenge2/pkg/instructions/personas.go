@@ -0,0 +1,125 @@
+package instructions
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PersonasDir is the directory relative to the root that keeps the persona instructions as <name>.txt files.
+const PersonasDir = "personas"
+
+// ErrUnknownPersona is returned when the requested persona does not exist.
+var ErrUnknownPersona = errors.New("unknown persona")
+
+var personaName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Personas keeps the named system instructions of the assistants that differ only by instructions,
+// e.g. business travel or family vacations.
+type Personas struct {
+	dir       string
+	mu        sync.Mutex
+	personas  map[string]*Version
+	listeners []func(map[string]*Version)
+}
+
+// NewPersonas loads the persona instructions from PersonasDir in root.
+// There are no personas when root is empty or the directory does not exist.
+func NewPersonas(root string) *Personas {
+	p := &Personas{personas: map[string]*Version{}}
+	if root == "" {
+		return p
+	}
+	p.dir = filepath.Join(root, PersonasDir)
+	personas, err := readPersonas(p.dir)
+	if err != nil {
+		slog.Error("failed to read personas", "error", err, "path", p.dir)
+		return p
+	}
+	p.personas = personas
+	slog.Info("personas are loaded", "count", len(personas))
+	return p
+}
+
+// Dir returns the personas directory or an empty string if it does not exist.
+func (p *Personas) Dir() string {
+	if p.dir == "" {
+		return ""
+	}
+	if fi, err := os.Stat(p.dir); err != nil || !fi.IsDir() {
+		return ""
+	}
+	return p.dir
+}
+
+// Reload reads the personas directory again. It is the callback of the file watcher for the files in the directory.
+// The personas are not changed if the directory cannot be read.
+func (p *Personas) Reload(path string) {
+	personas, err := readPersonas(p.dir)
+	if err != nil {
+		slog.Error("failed to read personas", "error", err, "path", path)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.personas = personas
+	for _, fn := range p.listeners {
+		fn(personas)
+	}
+	slog.Info("personas are reloaded", "count", len(personas), "path", path)
+}
+
+// OnChange calls fn with the current personas and then each time they are reloaded.
+// The map passed to fn must not be modified.
+func (p *Personas) OnChange(fn func(map[string]*Version)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn(p.personas)
+	p.listeners = append(p.listeners, fn)
+}
+
+// readPersonas reads <name>.txt files in dir. Files with invalid names or empty instructions are skipped.
+func readPersonas(dir string) (map[string]*Version, error) {
+	personas := map[string]*Version{}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return personas, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".txt")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if !personaName.MatchString(name) {
+			slog.Warn("persona name should use lowercase letters, digits, '-' and '_'; the file is skipped", "file", e.Name())
+			continue
+		}
+		v, err := readVersion(filepath.Join(dir, e.Name()))
+		if err != nil {
+			slog.Error("failed to read persona instructions", "error", err, "persona", name)
+			continue
+		}
+		v.Name = name
+		personas[name] = loaded(v)
+	}
+	return personas, nil
+}
+
+// SortedPersonas returns the personas ordered by name.
+func SortedPersonas(personas map[string]*Version) []*Version {
+	list := make([]*Version, 0, len(personas))
+	for _, v := range personas {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,134 @@
+package instructions
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePersona(t *testing.T, root, name, text string) string {
+	t.Helper()
+	dir := filepath.Join(root, PersonasDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func personaTexts(personas map[string]*Version) map[string]string {
+	texts := make(map[string]string, len(personas))
+	for name, v := range personas {
+		texts[name+"/"+v.Name] = v.Text
+	}
+	return texts
+}
+
+func TestNewPersonas(t *testing.T) {
+	root := t.TempDir()
+	writePersona(t, root, "business.txt", "You plan business trips.")
+	writePersona(t, root, "family_2.txt", "You plan family vacations.")
+	writePersona(t, root, "Bad Name.txt", "skipped")
+	writePersona(t, root, "empty.txt", "  \n")
+	writePersona(t, root, "notes.md", "skipped")
+	if err := os.Mkdir(filepath.Join(root, PersonasDir, "nested.txt"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPersonas(root)
+	if got, want := p.Dir(), filepath.Join(root, PersonasDir); got != want {
+		t.Errorf("Dir() = %q, want %q", got, want)
+	}
+	var got map[string]*Version
+	p.OnChange(func(personas map[string]*Version) { got = personas })
+	want := map[string]string{
+		"business/business": "You plan business trips.",
+		"family_2/family_2": "You plan family vacations.",
+	}
+	if texts := personaTexts(got); !maps.Equal(texts, want) {
+		t.Errorf("personas = %v, want %v", texts, want)
+	}
+	for _, v := range got {
+		if v.LoadedAt == nil {
+			t.Errorf("persona %q has no load time", v.Name)
+		}
+	}
+	sorted := SortedPersonas(got)
+	if len(sorted) != 2 || sorted[0].Name != "business" || sorted[1].Name != "family_2" {
+		t.Errorf("SortedPersonas() returned %v", sorted)
+	}
+}
+
+func TestNewPersonasWithoutDirectory(t *testing.T) {
+	for _, root := range []string{"", t.TempDir()} {
+		p := NewPersonas(root)
+		if dir := p.Dir(); dir != "" {
+			t.Errorf("Dir() of root %q = %q, want empty", root, dir)
+		}
+		p.OnChange(func(personas map[string]*Version) {
+			if len(personas) != 0 {
+				t.Errorf("root %q has %d personas, want none", root, len(personas))
+			}
+		})
+	}
+}
+
+func TestPersonasReload(t *testing.T) {
+	root := t.TempDir()
+	business := writePersona(t, root, "business.txt", "v1")
+	p := NewPersonas(root)
+	var calls []map[string]string
+	p.OnChange(func(personas map[string]*Version) { calls = append(calls, personaTexts(personas)) })
+
+	writePersona(t, root, "business.txt", "v2")
+	family := writePersona(t, root, "family.txt", "family")
+	p.Reload(family)
+	if err := os.Remove(business); err != nil {
+		t.Fatal(err)
+	}
+	p.Reload(business)
+	// the removed directory is the same as the directory without personas
+	if err := os.RemoveAll(filepath.Join(root, PersonasDir)); err != nil {
+		t.Fatal(err)
+	}
+	p.Reload(filepath.Join(root, PersonasDir))
+
+	want := []map[string]string{
+		{"business/business": "v1"},
+		{"business/business": "v2", "family/family": "family"},
+		{"family/family": "family"},
+		{},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("OnChange is called %d times, want %d: %v", len(calls), len(want), calls)
+	}
+	for i := range want {
+		if !maps.Equal(calls[i], want[i]) {
+			t.Errorf("call %d: personas = %v, want %v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestPersonasReloadError(t *testing.T) {
+	root := t.TempDir()
+	writePersona(t, root, "business.txt", "v1")
+	p := NewPersonas(root)
+	calls := 0
+	p.OnChange(func(map[string]*Version) { calls++ })
+	// the personas directory is replaced by a file that cannot be read as a directory
+	dir := filepath.Join(root, PersonasDir)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p.Reload(dir)
+	if calls != 1 {
+		t.Errorf("OnChange is called %d times after the failed reload, want 1", calls)
+	}
+}
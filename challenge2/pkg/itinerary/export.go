@@ -0,0 +1,205 @@
+package itinerary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FormatICS = "ics"
+	FormatGPX = "gpx"
+
+	// defaultDuration is used for the last activity of the day without duration
+	defaultDuration = time.Hour
+	icsTimeFormat   = "20060102T150405"
+)
+
+// ErrNoCoordinates is returned when none of the itinerary locations has coordinates.
+var ErrNoCoordinates = errors.New("itinerary locations have no coordinates")
+
+// ContentType returns MIME type of the export format.
+func ContentType(format string) (string, error) {
+	switch format {
+	case FormatICS:
+		return "text/calendar; charset=utf-8", nil
+	case FormatGPX:
+		return "application/gpx+xml", nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// Export returns the itinerary in the format. The first day of the trip is start.
+func (it *Itinerary) Export(format string, start time.Time) ([]byte, error) {
+	switch format {
+	case FormatICS:
+		return it.ICS(start), nil
+	case FormatGPX:
+		return it.GPX()
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// ICS returns iCalendar with an event per activity. The first day of the trip is start.
+// The event times are floating, so calendar apps show them in the local time of the traveler.
+// An activity without duration ends when the next activity starts.
+func (it *Itinerary) ICS(start time.Time) []byte {
+	var b bytes.Buffer
+	stamp := time.Now().UTC().Format(icsTimeFormat) + "Z"
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//minherz//aichallenges itinerary//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "X-WR-CALNAME:"+icsEscape(it.Title))
+	for i, d := range it.Days {
+		for j, a := range d.Activities {
+			begin := activityTime(start, i, a.Time)
+			end := begin.Add(defaultDuration)
+			switch {
+			case a.DurationMinutes > 0:
+				end = begin.Add(time.Duration(a.DurationMinutes) * time.Minute)
+			case j+1 < len(d.Activities):
+				if next := activityTime(start, i, d.Activities[j+1].Time); next.After(begin) {
+					end = next
+				}
+			}
+			description := a.Description
+			if a.Cost > 0 {
+				description = strings.TrimSpace(fmt.Sprintf("%s\nEstimated cost: %.2f %s", description, a.Cost, it.Currency))
+			}
+			writeICSLine(&b, "BEGIN:VEVENT")
+			writeICSLine(&b, "UID:"+eventUID(it, i, j))
+			writeICSLine(&b, "DTSTAMP:"+stamp)
+			writeICSLine(&b, "DTSTART:"+begin.Format(icsTimeFormat))
+			writeICSLine(&b, "DTEND:"+end.Format(icsTimeFormat))
+			writeICSLine(&b, "SUMMARY:"+icsEscape(a.Title))
+			location := a.Location.Name
+			if a.Location.Address != "" {
+				location += ", " + a.Location.Address
+			}
+			writeICSLine(&b, "LOCATION:"+icsEscape(location))
+			if a.Location.Latitude != nil && a.Location.Longitude != nil {
+				writeICSLine(&b, fmt.Sprintf("GEO:%f;%f", *a.Location.Latitude, *a.Location.Longitude))
+			}
+			if description != "" {
+				writeICSLine(&b, "DESCRIPTION:"+icsEscape(description))
+			}
+			writeICSLine(&b, "END:VEVENT")
+		}
+	}
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.Bytes()
+}
+
+func activityTime(start time.Time, day int, hhmm string) time.Time {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		// validated itineraries have valid times
+		return time.Date(start.Year(), start.Month(), start.Day()+day, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(start.Year(), start.Month(), start.Day()+day, t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func eventUID(it *Itinerary, day, activity int) string {
+	h := sha256.Sum256([]byte(it.Title + "\x00" + it.Destination))
+	return fmt.Sprintf("%s-%d-%d@aichallenges", hex.EncodeToString(h[:8]), day+1, activity+1)
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// writeICSLine writes the content line folded to 75 octets as required by RFC 5545.
+func writeICSLine(b *bytes.Buffer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// do not split multi-byte characters
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// continuation lines start with the space
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+type gpxFile struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Points   []gpxPoint  `xml:"wpt"`
+	Routes   []gpxRoute  `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string     `xml:"name"`
+	Points []gpxPoint `xml:"rtept"`
+}
+
+// GPX returns GPX 1.1 file with a waypoint per activity location and a route per day.
+// Locations without coordinates are skipped.
+func (it *Itinerary) GPX() ([]byte, error) {
+	f := gpxFile{
+		Version:  "1.1",
+		Creator:  "aichallenges",
+		XMLNS:    "http://www.topografix.com/GPX/1/1",
+		Metadata: gpxMetadata{Name: it.Title, Desc: it.Destination},
+	}
+	for _, d := range it.Days {
+		route := gpxRoute{Name: fmt.Sprintf("Day %d", d.Day)}
+		if d.Title != "" {
+			route.Name += ": " + d.Title
+		}
+		for _, a := range d.Activities {
+			l := a.Location
+			if l.Latitude == nil || l.Longitude == nil {
+				continue
+			}
+			p := gpxPoint{
+				Lat:  *l.Latitude,
+				Lon:  *l.Longitude,
+				Name: l.Name,
+				Desc: a.Title,
+			}
+			f.Points = append(f.Points, p)
+			route.Points = append(route.Points, p)
+		}
+		if len(route.Points) > 0 {
+			f.Routes = append(f.Routes, route)
+		}
+	}
+	if len(f.Points) == 0 {
+		return nil, ErrNoCoordinates
+	}
+	data, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal GPX: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
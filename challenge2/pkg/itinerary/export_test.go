@@ -0,0 +1,213 @@
+package itinerary
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWriteICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "short",
+			line: "SUMMARY:Colosseum",
+			want: "SUMMARY:Colosseum\r\n",
+		},
+		{
+			name: "75 octets",
+			line: "SUMMARY:" + strings.Repeat("a", 67),
+			want: "SUMMARY:" + strings.Repeat("a", 67) + "\r\n",
+		},
+		{
+			name: "76 octets",
+			line: "SUMMARY:" + strings.Repeat("a", 68),
+			want: "SUMMARY:" + strings.Repeat("a", 67) + "\r\n a\r\n",
+		},
+		{
+			name: "continuation lines",
+			line: strings.Repeat("a", 75) + strings.Repeat("b", 74) + strings.Repeat("c", 74) + "d",
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("b", 74) + "\r\n " + strings.Repeat("c", 74) + "\r\n d\r\n",
+		},
+		{
+			name: "two byte character at the limit",
+			// é takes octets 75 and 76, so it moves to the next line
+			line: strings.Repeat("a", 74) + "éz",
+			want: strings.Repeat("a", 74) + "\r\n éz\r\n",
+		},
+		{
+			name: "three byte character at the limit",
+			// € takes octets 74-76
+			line: strings.Repeat("a", 73) + "€z",
+			want: strings.Repeat("a", 73) + "\r\n €z\r\n",
+		},
+		{
+			name: "four byte character at the limit",
+			line: strings.Repeat("a", 72) + "🏛z",
+			want: strings.Repeat("a", 72) + "\r\n 🏛z\r\n",
+		},
+		{
+			name: "multibyte characters",
+			line: "SUMMARY:" + strings.Repeat("東京", 20),
+			// the 23rd character would end at octet 77
+			want: "SUMMARY:" + strings.Repeat("東京", 11) + "\r\n " + strings.Repeat("東京", 9) + "\r\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeICSLine(&b, tc.line)
+			got := b.String()
+			if got != tc.want {
+				t.Errorf("writeICSLine(%q) = %q, want %q", tc.line, got, tc.want)
+			}
+			for i, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line %d has %d octets", i, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d %q splits a character", i, line)
+				}
+			}
+		})
+	}
+}
+
+func TestICSEscape(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Colosseum", "Colosseum"},
+		{"Piazza del Colosseo, 1; Rome", `Piazza del Colosseo\, 1\; Rome`},
+		{`C:\tickets`, `C:\\tickets`},
+		{"line 1\nline 2\r\nline 3", `line 1\nline 2\nline 3`},
+		{`\,`, `\\\,`},
+	}
+	for _, tc := range tests {
+		if got := icsEscape(tc.text); got != tc.want {
+			t.Errorf("icsEscape(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func exportItinerary() *Itinerary {
+	lat, lon := 41.890251, 12.492373
+	pLat, pLon := 41.898609, 12.476873
+	return &Itinerary{
+		Title:       "Rome, Florence & more",
+		Destination: "Italy",
+		Currency:    "EUR",
+		Days: []Day{
+			{
+				Day:   1,
+				Title: "Ancient Rome",
+				Activities: []Activity{
+					{
+						Time:            "09:00",
+						Title:           "Colosseum; Forum",
+						Description:     "Skip-the-line tour\nBring water",
+						Location:        Location{Name: "Colosseum", Address: "Piazza del Colosseo, 1", Latitude: &lat, Longitude: &lon},
+						DurationMinutes: 180,
+						Cost:            18,
+					},
+					{
+						Time:     "13:00",
+						Title:    "Lunch",
+						Location: Location{Name: "Trattoria"},
+					},
+					{
+						Time:     "15:30",
+						Title:    "Pantheon",
+						Location: Location{Name: "Pantheon", Latitude: &pLat, Longitude: &pLon},
+						Cost:     5,
+					},
+				},
+			},
+			{
+				Day: 2,
+				Activities: []Activity{
+					{
+						Time:        "10:00",
+						Title:       "Uffizi Gallery with the long guided tour of the Renaissance masterpieces",
+						Description: "Botticelli, Leonardo, Michelangelo — the whole collection",
+						Location:    Location{Name: "Galleria degli Uffizi"},
+						Cost:        25,
+					},
+				},
+			},
+		},
+		TotalCost: 48,
+	}
+}
+
+var dtstamp = regexp.MustCompile(`DTSTAMP:\d{8}T\d{6}Z`)
+
+func TestICS(t *testing.T) {
+	got := exportItinerary().ICS(time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC))
+	if n := len(dtstamp.FindAll(got, -1)); n != 4 {
+		t.Errorf("ICS has %d DTSTAMP lines, want 4", n)
+	}
+	// the stamp is the export time
+	got = dtstamp.ReplaceAll(got, []byte("DTSTAMP:20240501T120000Z"))
+	compareGolden(t, "rome.ics", got)
+}
+
+func TestGPX(t *testing.T) {
+	got, err := exportItinerary().GPX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "rome.gpx", got)
+}
+
+func TestGPXWithoutCoordinates(t *testing.T) {
+	it := exportItinerary()
+	for i := range it.Days {
+		for j := range it.Days[i].Activities {
+			it.Days[i].Activities[j].Location.Latitude = nil
+		}
+	}
+	if _, err := it.GPX(); !errors.Is(err, ErrNoCoordinates) {
+		t.Errorf("GPX() error = %v, want %v", err, ErrNoCoordinates)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	it := exportItinerary()
+	start := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	for _, format := range []string{FormatICS, FormatGPX} {
+		if _, err := ContentType(format); err != nil {
+			t.Errorf("ContentType(%q) error = %v", format, err)
+		}
+		if _, err := it.Export(format, start); err != nil {
+			t.Errorf("Export(%q) error = %v", format, err)
+		}
+	}
+	if _, err := ContentType("kml"); err == nil {
+		t.Error("ContentType(kml) succeeded")
+	}
+	if _, err := it.Export("kml", start); err == nil {
+		t.Error("Export(kml) succeeded")
+	}
+}
+
+func compareGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	want, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Package itinerary generates travel itineraries as structured JSON.
+package itinerary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+const DefaultMaxAttempts = 3
+
+var systemInstructions = []string{
+	"You are a friendly and helpful trip planning assistant.",
+	"Create a day by day itinerary for the trip that the user asks about.",
+	"Number the days starting from 1 and list the activities of each day in chronological order.",
+	"Use 24-hour HH:MM format for the start times of the activities.",
+	"Estimate the cost of each activity per person as a number in the currency of the destination and use ISO 4217 currency codes.",
+	"Use 0 for free activities.",
+	"Include latitude and longitude of the locations when you know them.",
+	"Respond with JSON only.",
+}
+
+var timePattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// ErrInvalid is returned when the model response does not match the itinerary schema.
+var ErrInvalid = errors.New("invalid itinerary")
+
+type Location struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+type Activity struct {
+	Time            string   `json:"time"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description,omitempty"`
+	Location        Location `json:"location"`
+	DurationMinutes int      `json:"duration_minutes,omitempty"`
+	Cost            float64  `json:"cost"`
+}
+
+type Day struct {
+	Day        int        `json:"day"`
+	Title      string     `json:"title,omitempty"`
+	Activities []Activity `json:"activities"`
+}
+
+// Itinerary is the day by day plan of the trip. Costs are per person in the Currency.
+type Itinerary struct {
+	Title       string  `json:"title"`
+	Destination string  `json:"destination"`
+	Currency    string  `json:"currency"`
+	Days        []Day   `json:"days"`
+	TotalCost   float64 `json:"total_cost"`
+}
+
+// Schema returns the response schema of the itinerary.
+func Schema() *llm.Schema {
+	location := &llm.Schema{
+		Type:        llm.TypeObject,
+		Description: "The place of the activity",
+		Properties: map[string]*llm.Schema{
+			"name":      {Type: llm.TypeString},
+			"address":   {Type: llm.TypeString, Nullable: true},
+			"latitude":  {Type: llm.TypeNumber, Nullable: true},
+			"longitude": {Type: llm.TypeNumber, Nullable: true},
+		},
+		Required: []string{"name"},
+	}
+	activity := &llm.Schema{
+		Type: llm.TypeObject,
+		Properties: map[string]*llm.Schema{
+			"time":             {Type: llm.TypeString, Description: "Start time in HH:MM format"},
+			"title":            {Type: llm.TypeString},
+			"description":      {Type: llm.TypeString, Nullable: true},
+			"location":         location,
+			"duration_minutes": {Type: llm.TypeInteger, Nullable: true},
+			"cost":             {Type: llm.TypeNumber, Description: "Estimated cost per person, 0 if free"},
+		},
+		Required: []string{"time", "title", "location", "cost"},
+	}
+	day := &llm.Schema{
+		Type: llm.TypeObject,
+		Properties: map[string]*llm.Schema{
+			"day":        {Type: llm.TypeInteger, Description: "Day number starting from 1"},
+			"title":      {Type: llm.TypeString, Nullable: true},
+			"activities": {Type: llm.TypeArray, Items: activity},
+		},
+		Required: []string{"day", "activities"},
+	}
+	return &llm.Schema{
+		Type: llm.TypeObject,
+		Properties: map[string]*llm.Schema{
+			"title":       {Type: llm.TypeString},
+			"destination": {Type: llm.TypeString},
+			"currency":    {Type: llm.TypeString, Description: "ISO 4217 currency code"},
+			"days":        {Type: llm.TypeArray, Items: day},
+			"total_cost":  {Type: llm.TypeNumber, Description: "Sum of the activity costs"},
+		},
+		Required: []string{"title", "destination", "currency", "days", "total_cost"},
+	}
+}
+
+// Parse decodes the JSON response of the model and validates it.
+func Parse(text string) (*Itinerary, error) {
+	text = strings.TrimSpace(guardrails.StripCodeFences(text))
+	d := json.NewDecoder(bytes.NewReader([]byte(text)))
+	d.DisallowUnknownFields()
+	var it Itinerary
+	if err := d.Decode(&it); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := it.Validate(); err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// Validate checks the constraints that the schema cannot express.
+func (it *Itinerary) Validate() error {
+	var errs []error
+	if strings.TrimSpace(it.Title) == "" {
+		errs = append(errs, fmt.Errorf("title is empty"))
+	}
+	if strings.TrimSpace(it.Destination) == "" {
+		errs = append(errs, fmt.Errorf("destination is empty"))
+	}
+	if len(it.Currency) != 3 {
+		errs = append(errs, fmt.Errorf("currency %q is not ISO 4217 code", it.Currency))
+	}
+	if len(it.Days) == 0 {
+		errs = append(errs, fmt.Errorf("itinerary has no days"))
+	}
+	var total float64
+	for i, d := range it.Days {
+		if d.Day != i+1 {
+			errs = append(errs, fmt.Errorf("days[%d]: day number is %d, expected %d", i, d.Day, i+1))
+		}
+		if len(d.Activities) == 0 {
+			errs = append(errs, fmt.Errorf("days[%d]: day has no activities", i))
+		}
+		prev := ""
+		for j, a := range d.Activities {
+			field := fmt.Sprintf("days[%d].activities[%d]", i, j)
+			if !timePattern.MatchString(a.Time) {
+				errs = append(errs, fmt.Errorf("%s: time %q is not in HH:MM format", field, a.Time))
+			} else if a.Time < prev {
+				errs = append(errs, fmt.Errorf("%s: time %s is before the previous activity", field, a.Time))
+			} else {
+				prev = a.Time
+			}
+			if strings.TrimSpace(a.Title) == "" {
+				errs = append(errs, fmt.Errorf("%s: title is empty", field))
+			}
+			if strings.TrimSpace(a.Location.Name) == "" {
+				errs = append(errs, fmt.Errorf("%s: location name is empty", field))
+			}
+			if l := a.Location; l.Latitude != nil && (*l.Latitude < -90 || *l.Latitude > 90) ||
+				l.Longitude != nil && (*l.Longitude < -180 || *l.Longitude > 180) {
+				errs = append(errs, fmt.Errorf("%s: location coordinates are out of range", field))
+			}
+			if a.Cost < 0 {
+				errs = append(errs, fmt.Errorf("%s: cost is negative", field))
+			}
+			if a.DurationMinutes < 0 {
+				errs = append(errs, fmt.Errorf("%s: duration is negative", field))
+			}
+			total += a.Cost
+		}
+	}
+	if it.TotalCost < 0 {
+		errs = append(errs, fmt.Errorf("total cost is negative"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	// the model is not good at arithmetic, so the total is computed instead of being validated
+	it.TotalCost = total
+	return nil
+}
+
+// Generator asks the model for itineraries and retries when the response does not match the schema.
+type Generator struct {
+	m           llm.Model
+	maxAttempts int
+	config      llm.GenerationConfig
+	safety      []llm.SafetySetting
+}
+
+// NewGenerator returns the generator that makes up to maxAttempts calls to m per itinerary.
+func NewGenerator(m llm.Model, maxAttempts int, safety []llm.SafetySetting) *Generator {
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &Generator{
+		m:           m,
+		maxAttempts: maxAttempts,
+		config:      llm.GenerationConfig{ResponseMIMEType: llm.MIMETypeJSON, ResponseSchema: Schema()},
+		safety:      safety,
+	}
+}
+
+// Generate returns the itinerary for the user message. If the model response is blocked or refused,
+// it returns nil itinerary and the response.
+func (g *Generator) Generate(ctx context.Context, message string) (*Itinerary, *llm.Response, error) {
+	return g.generate(ctx, []llm.Message{{Role: llm.RoleUser, Text: message}})
+}
+
+// FromConversation is like Generate but returns the itinerary of the trip that was planned in the conversation.
+func (g *Generator) FromConversation(ctx context.Context, history []llm.Message) (*Itinerary, *llm.Response, error) {
+	if len(history) == 0 {
+		return nil, nil, fmt.Errorf("conversation is empty")
+	}
+	messages := append(slices.Clone(history), llm.Message{
+		Role: llm.RoleUser,
+		Text: "Create the itinerary of the trip that we planned in this conversation.",
+	})
+	return g.generate(ctx, messages)
+}
+
+func (g *Generator) generate(ctx context.Context, messages []llm.Message) (*Itinerary, *llm.Response, error) {
+	req := &llm.Request{Messages: messages}
+	req.SystemInstruction = strings.Join(systemInstructions, " ")
+	req.Config = g.config
+	req.SafetySettings = g.safety
+	var err error
+	for attempt := 1; attempt <= g.maxAttempts; attempt++ {
+		var resp *llm.Response
+		resp, err = g.m.Generate(ctx, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.FinishReason.Blocked() || resp.FinishReason == llm.FinishReasonRefused {
+			return nil, resp, nil
+		}
+		var it *Itinerary
+		if it, err = Parse(resp.Text); err == nil {
+			return it, resp, nil
+		}
+		slog.Warn("model returned invalid itinerary", "attempt", attempt, "error", err)
+		// show the model its mistakes so it can fix them
+		req.Messages = append(req.Messages,
+			llm.Message{Role: llm.RoleModel, Text: resp.Text},
+			llm.Message{Role: llm.RoleUser, Text: "The response is not valid: " + err.Error() + "\nReturn the corrected itinerary as JSON."})
+	}
+	return nil, nil, fmt.Errorf("no valid itinerary after %d attempts: %w", g.maxAttempts, err)
+}
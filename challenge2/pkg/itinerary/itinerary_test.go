@@ -0,0 +1,254 @@
+package itinerary
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+const validItinerary = `{
+	"title": "Weekend in Rome",
+	"destination": "Rome",
+	"currency": "EUR",
+	"days": [
+		{"day": 1, "activities": [
+			{"time": "09:00", "title": "Colosseum", "location": {"name": "Colosseum", "latitude": 41.89, "longitude": 12.49}, "cost": 18},
+			{"time": "13:30", "title": "Lunch", "location": {"name": "Trastevere"}, "cost": 25.5}
+		]},
+		{"day": 2, "activities": [
+			{"time": "10:00", "title": "Pantheon", "location": {"name": "Pantheon"}, "cost": 0}
+		]}
+	],
+	"total_cost": 999
+}`
+
+// stubModel returns the responses in order and records the requests.
+type stubModel struct {
+	responses []*llm.Response
+	requests  []*llm.Request
+}
+
+func (m *stubModel) Name() string { return "stub" }
+
+func (m *stubModel) Generate(_ context.Context, req *llm.Request) (*llm.Response, error) {
+	// the generator appends to the messages of the same request
+	c := *req
+	c.Messages = slices.Clone(req.Messages)
+	m.requests = append(m.requests, &c)
+	if len(m.responses) == 0 {
+		return nil, errors.New("unexpected model call")
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func (m *stubModel) Stream(ctx context.Context, req *llm.Request, _ llm.StreamFunc) (*llm.Response, error) {
+	return m.Generate(ctx, req)
+}
+
+func (m *stubModel) Close() error { return nil }
+
+func text(s string) *llm.Response {
+	return &llm.Response{Text: s, FinishReason: llm.FinishReasonStop}
+}
+
+func TestParse(t *testing.T) {
+	it, err := Parse("```json\n" + validItinerary + "\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Title != "Weekend in Rome" || len(it.Days) != 2 || len(it.Days[0].Activities) != 2 {
+		t.Errorf("Parse() = %+v", it)
+	}
+	// the total cost of the model is replaced by the sum of the activity costs
+	if it.TotalCost != 43.5 {
+		t.Errorf("TotalCost = %v, want 43.5", it.TotalCost)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "not JSON",
+			text: "Here is your itinerary: day 1 Rome",
+			want: "invalid character",
+		},
+		{
+			name: "unknown field",
+			text: strings.Replace(validItinerary, `"title": "Weekend in Rome",`, `"title": "Weekend in Rome", "hotel": "Hilton",`, 1),
+			want: `unknown field "hotel"`,
+		},
+		{
+			name: "unknown nested field",
+			text: strings.Replace(validItinerary, `"cost": 0`, `"cost": 0, "rating": 5`, 1),
+			want: `unknown field "rating"`,
+		},
+		{
+			name: "wrong type",
+			text: strings.Replace(validItinerary, `"cost": 0`, `"cost": "free"`, 1),
+			want: "cannot unmarshal string",
+		},
+		{
+			name: "currency",
+			text: strings.Replace(validItinerary, `"EUR"`, `"euro"`, 1),
+			want: `currency "euro" is not ISO 4217 code`,
+		},
+		{
+			name: "day number",
+			text: strings.Replace(validItinerary, `"day": 2`, `"day": 3`, 1),
+			want: "days[1]: day number is 3, expected 2",
+		},
+		{
+			name: "time format",
+			text: strings.Replace(validItinerary, `"13:30"`, `"1:30 PM"`, 1),
+			want: `days[0].activities[1]: time "1:30 PM" is not in HH:MM format`,
+		},
+		{
+			name: "time order",
+			text: strings.Replace(validItinerary, `"13:30"`, `"08:00"`, 1),
+			want: "days[0].activities[1]: time 08:00 is before the previous activity",
+		},
+		{
+			name: "coordinates",
+			text: strings.Replace(validItinerary, `41.89`, `141.89`, 1),
+			want: "days[0].activities[0]: location coordinates are out of range",
+		},
+		{
+			name: "negative cost",
+			text: strings.Replace(validItinerary, `"cost": 18`, `"cost": -18`, 1),
+			want: "days[0].activities[0]: cost is negative",
+		},
+		{
+			name: "no days",
+			text: `{"title": "Rome", "destination": "Rome", "currency": "EUR", "days": [], "total_cost": 0}`,
+			want: "itinerary has no days",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.text)
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Parse() error = %v, want %v", err, ErrInvalid)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Parse() error = %q, want to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	it := &Itinerary{Currency: "EUR", Days: []Day{{Day: 2}}, TotalCost: 10}
+	err := it.Validate()
+	for _, want := range []string{"title is empty", "destination is empty", "day number is 2", "day has no activities"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want to contain %q", err, want)
+		}
+	}
+	// the total cost is not recomputed for the invalid itinerary
+	if it.TotalCost != 10 {
+		t.Errorf("TotalCost = %v, want 10", it.TotalCost)
+	}
+}
+
+func TestGenerateRetries(t *testing.T) {
+	responses := []*llm.Response{
+		text("Sure! Here is your trip to Rome."),
+		text(strings.Replace(validItinerary, `"EUR"`, `"euro"`, 1)),
+		text(validItinerary),
+	}
+	m := &stubModel{responses: slices.Clone(responses)}
+	g := NewGenerator(m, 3, nil)
+	it, resp, err := g.Generate(context.Background(), "Plan a weekend in Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it == nil || it.TotalCost != 43.5 {
+		t.Fatalf("Generate() = %+v, want the valid itinerary", it)
+	}
+	if resp.Text != validItinerary {
+		t.Errorf("Generate() response = %q, want the last response", resp.Text)
+	}
+	if len(m.requests) != 3 {
+		t.Fatalf("model is called %d times, want 3", len(m.requests))
+	}
+	first := m.requests[0]
+	if first.Config.ResponseMIMEType != llm.MIMETypeJSON || first.Config.ResponseSchema == nil {
+		t.Errorf("request config = %+v, want JSON response with schema", first.Config)
+	}
+	if len(first.Messages) != 1 || first.Messages[0].Text != "Plan a weekend in Rome" {
+		t.Errorf("first request messages = %+v", first.Messages)
+	}
+	// each retry shows the model its response and the errors
+	for i, want := range []string{"invalid character", `currency "euro" is not ISO 4217 code`} {
+		req := m.requests[i+1]
+		if len(req.Messages) != 3+2*i {
+			t.Fatalf("request %d has %d messages, want %d", i+1, len(req.Messages), 3+2*i)
+		}
+		model, feedback := req.Messages[len(req.Messages)-2], req.Messages[len(req.Messages)-1]
+		if model.Role != llm.RoleModel || model.Text != responses[i].Text {
+			t.Errorf("request %d: message %+v, want the model response", i+1, model)
+		}
+		if feedback.Role != llm.RoleUser || !strings.Contains(feedback.Text, want) {
+			t.Errorf("request %d: feedback %q, want to contain %q", i+1, feedback.Text, want)
+		}
+	}
+}
+
+func TestGenerateFails(t *testing.T) {
+	m := &stubModel{responses: []*llm.Response{text("not JSON"), text("still not JSON")}}
+	g := NewGenerator(m, 2, nil)
+	it, _, err := g.Generate(context.Background(), "Plan a weekend in Rome")
+	if it != nil || !errors.Is(err, ErrInvalid) {
+		t.Errorf("Generate() = %v, %v, want %v", it, err, ErrInvalid)
+	}
+	if len(m.requests) != 2 {
+		t.Errorf("model is called %d times, want 2", len(m.requests))
+	}
+}
+
+func TestGenerateBlocked(t *testing.T) {
+	for _, reason := range []llm.FinishReason{llm.FinishReasonSafety, llm.FinishReasonRefused} {
+		t.Run(string(reason), func(t *testing.T) {
+			m := &stubModel{responses: []*llm.Response{{Text: "no", FinishReason: reason}}}
+			g := NewGenerator(m, 3, nil)
+			it, resp, err := g.Generate(context.Background(), "Plan a weekend in Rome")
+			if err != nil || it != nil || resp == nil || resp.FinishReason != reason {
+				t.Errorf("Generate() = %v, %+v, %v, want the %s response", it, resp, err, reason)
+			}
+			if len(m.requests) != 1 {
+				t.Errorf("model is called %d times, want 1", len(m.requests))
+			}
+		})
+	}
+}
+
+func TestFromConversation(t *testing.T) {
+	m := &stubModel{responses: []*llm.Response{text(validItinerary)}}
+	g := NewGenerator(m, 1, nil)
+	history := []llm.Message{
+		{Role: llm.RoleUser, Text: "I want to visit Rome"},
+		{Role: llm.RoleModel, Text: "Rome is great in spring"},
+	}
+	if _, _, err := g.FromConversation(context.Background(), history); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.requests[0].Messages); got != 3 {
+		t.Errorf("request has %d messages, want 3", got)
+	}
+	if len(history) != 2 {
+		t.Errorf("history is modified")
+	}
+	if _, _, err := g.FromConversation(context.Background(), nil); err == nil {
+		t.Error("FromConversation() of empty conversation succeeded")
+	}
+}
@@ -0,0 +1,48 @@
+package itinerary
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+var page = template.Must(template.New("itinerary").Funcs(template.FuncMap{
+	"cost":    formatCost,
+	"mapLink": mapLink,
+}).Parse(`<h2>{{.Title}}</h2>
+<p>{{.Destination}}</p>
+{{range .Days}}<h3>Day {{.Day}}{{if .Title}}: {{.Title}}{{end}}</h3>
+<table>
+<thead><tr><th>Time</th><th>Activity</th><th>Location</th><th>Cost</th></tr></thead>
+<tbody>
+{{range .Activities}}<tr><td>{{.Time}}{{if .DurationMinutes}} ({{.DurationMinutes}} min){{end}}</td><td><strong>{{.Title}}</strong>{{if .Description}}<br>{{.Description}}{{end}}</td><td><a href="{{mapLink .Location}}" target="_blank" rel="noopener noreferrer">{{.Location.Name}}</a>{{if .Location.Address}}<br>{{.Location.Address}}{{end}}</td><td>{{cost .Cost $.Currency}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}<p><strong>Total per person: {{cost .TotalCost .Currency}}</strong></p>
+`))
+
+// HTML renders the itinerary as HTML that is safe to assign to innerHTML.
+func (it *Itinerary) HTML() (string, error) {
+	var b strings.Builder
+	if err := page.Execute(&b, it); err != nil {
+		return "", fmt.Errorf("cannot render itinerary: %w", err)
+	}
+	return b.String(), nil
+}
+
+func formatCost(cost float64, currency string) string {
+	if cost == 0 {
+		return "free"
+	}
+	return fmt.Sprintf("%.2f %s", cost, currency)
+}
+
+// mapLink returns Google Maps search URL of the location.
+func mapLink(l Location) string {
+	query := strings.TrimSpace(l.Name + " " + l.Address)
+	if l.Latitude != nil && l.Longitude != nil {
+		query = fmt.Sprintf("%f,%f", *l.Latitude, *l.Longitude)
+	}
+	return "https://www.google.com/maps/search/?api=1&query=" + url.QueryEscape(query)
+}
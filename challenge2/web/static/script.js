@@ -9,13 +9,19 @@ function extractIdsFromString(message) {
     return ids;
 }
 
-function createUserMessage(message) {
+function createUserMessage(message, files) {
     const usermessage = document.createElement("p");
     const userMessageSpan = document.createElement("span");
     userMessageSpan.innerText = message;
     userMessageSpan.classList.add("user-message-text");
     usermessage.classList.add("user-message");
     usermessage.appendChild(userMessageSpan);
+    if (files.length > 0) {
+        const filesSpan = document.createElement("span");
+        filesSpan.innerText = "📎 " + files.map((f) => f.name).join(", ");
+        filesSpan.classList.add("user-message-files");
+        userMessageSpan.appendChild(filesSpan);
+    }
     return usermessage;
 }
 
@@ -23,6 +29,12 @@ var sessionId = ""
 const botmessages = document.getElementById("bot-messages");
 const botbutton = document.getElementById("bot-input-button");
 const botinput = document.getElementById("bot-input-text");
+const botfiles = document.getElementById("bot-input-files");
+const botattach = document.getElementById("bot-input-attach");
+const botpersona = document.getElementById("bot-persona");
+const exportstart = document.getElementById("bot-export-start");
+const exportics = document.getElementById("bot-export-ics");
+const exportgpx = document.getElementById("bot-export-gpx");
 
 async function main() {
     botbutton.addEventListener("click", handleButtonClick);
@@ -31,6 +43,66 @@ async function main() {
             botbutton.click();
         }
     });
+    botattach.addEventListener("click", () => botfiles.click());
+    botfiles.addEventListener("change", () => {
+        botattach.classList.toggle("attached", botfiles.files.length > 0);
+        botattach.title = botfiles.files.length > 0 ?
+            Array.from(botfiles.files).map((f) => f.name).join(", ") : "Attach photos or PDF documents";
+    });
+    const tomorrow = new Date();
+    tomorrow.setDate(tomorrow.getDate() + 1);
+    exportstart.value = tomorrow.toISOString().slice(0, 10);
+    exportics.addEventListener("click", () => downloadItinerary("ics"));
+    exportgpx.addEventListener("click", () => downloadItinerary("gpx"));
+    await loadPersonas();
+}
+
+// loadPersonas shows the persona selector if the service has personas
+async function loadPersonas() {
+    const response = await fetch("personas");
+    if (response.status !== 200) {
+        return;
+    }
+    const responseJson = await response.json();
+    if (!responseJson.personas || responseJson.personas.length === 0) {
+        return;
+    }
+    botpersona.appendChild(new Option("Default assistant", ""));
+    responseJson.personas.forEach((p) => {
+        const title = p.name.replace(/[-_]/g, " ");
+        botpersona.appendChild(new Option(title.charAt(0).toUpperCase() + title.slice(1), p.name));
+    });
+    botpersona.hidden = false;
+}
+
+// downloadItinerary exports the trip planned in the chat session
+async function downloadItinerary(format) {
+    if (!sessionId) {
+        return;
+    }
+    exportics.disabled = true;
+    exportgpx.disabled = true;
+    const params = new URLSearchParams({ session: sessionId, format: format, start: exportstart.value });
+    const response = await fetch("itinerary/export?" + params.toString());
+    if (response.status === 200) {
+        const blob = await response.blob();
+        const link = document.createElement("a");
+        link.href = URL.createObjectURL(blob);
+        link.download = "itinerary." + format;
+        link.click();
+        URL.revokeObjectURL(link.href);
+    } else {
+        const botmessage = document.createElement("p");
+        const botmessagespan = document.createElement("span");
+        const responseJson = await response.json();
+        botmessagespan.innerText = Object.hasOwn(responseJson, 'error') ? responseJson.error : 'unknown error';
+        botmessage.classList.add("bot-message");
+        botmessage.appendChild(botmessagespan);
+        botmessages.appendChild(botmessage);
+        botmessages.scrollTo(0, botmessages.scrollHeight);
+    }
+    exportics.disabled = false;
+    exportgpx.disabled = false;
 }
 
 async function handleButtonClick() {
@@ -40,15 +112,19 @@ async function handleButtonClick() {
     }
 
     const message = botinput.value;
+    const files = Array.from(botfiles.files);
     console.log("message: " + message);
-    const usermessage = createUserMessage(message);
+    const usermessage = createUserMessage(message, files);
     botmessages.appendChild(usermessage);
     botmessages.scrollTo(0, botmessages.scrollHeight);
     botinput.value = "";
+    botfiles.value = "";
+    botattach.classList.remove("attached");
 
     // Disable send button and input field
     botbutton.disabled = true;
     botinput.disabled = true;
+    botattach.disabled = true;
     console.log("bot is typing");
 
     // Construct and render placeholder bot message
@@ -62,7 +138,8 @@ async function handleButtonClick() {
     botmessages.scrollTo(0, botmessages.scrollHeight);
 
     // Request a response from the Shopping Assistant
-    const response = await fetch("ask", {
+    // Attached files are sent as multipart form
+    var request = {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -70,14 +147,33 @@ async function handleButtonClick() {
         body: JSON.stringify({
             message: message,
             session: sessionId,
+            persona: botpersona.value,
         }),
-    });
+    };
+    if (files.length > 0) {
+        const form = new FormData();
+        form.append("message", message);
+        form.append("session", sessionId);
+        form.append("persona", botpersona.value);
+        files.forEach((f) => form.append("files", f));
+        request = { method: "POST", body: form };
+    }
+    const response = await fetch("ask", request);
     const responseJson = await response.json();
     if (response.status === 200) {
         console.log(responseJson);
         // refresh session Id
         sessionId = responseJson.session
-        botmessagespan.innerText = responseJson.message;
+        // the persona is bound to the session with the first message
+        botpersona.disabled = true;
+        exportics.disabled = false;
+        exportgpx.disabled = false;
+        // html is sanitized by the server
+        if (Object.hasOwn(responseJson, 'html')) {
+            botmessagespan.innerHTML = responseJson.html;
+        } else {
+            botmessagespan.innerText = responseJson.message;
+        }
     } else {
         if (Object.hasOwn(responseJson, 'error')) {
             botmessagespan.innerText = responseJson.error;
@@ -94,6 +190,7 @@ async function handleButtonClick() {
     // Re-enable button and input field
     botbutton.disabled = false;
     botinput.disabled = false;
+    botattach.disabled = false;
     botinput.focus();
 }
 
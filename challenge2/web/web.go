@@ -0,0 +1,16 @@
+// Package web holds the files of the web UI that are embedded into the service binary.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var files embed.FS
+
+// Static returns the files of the web UI.
+func Static() fs.FS {
+	static, _ := fs.Sub(files, "static")
+	return static
+}
@@ -1,25 +1,28 @@
-module github.com/minherz/aichallenges/challenge1
+module github.com/minherz/aichallenges/challenge5
 
 go 1.22.6
 
 require (
-	cloud.google.com/go/aiplatform v1.69.0
 	cloud.google.com/go/bigquery v1.64.0
-	cloud.google.com/go/compute/metadata v0.5.2
-	cloud.google.com/go/vertexai v0.13.3
 	github.com/labstack/echo/v4 v4.13.3
+	github.com/minherz/aichallenges/shared v0.0.0
 	google.golang.org/api v0.211.0
-	google.golang.org/protobuf v1.35.2
+	google.golang.org/grpc v1.67.3
 )
 
 require (
 	cloud.google.com/go v0.116.0 // indirect
+	cloud.google.com/go/aiplatform v1.69.0 // indirect
 	cloud.google.com/go/auth v0.12.1 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.6 // indirect
+	cloud.google.com/go/compute/metadata v0.5.2 // indirect
+	cloud.google.com/go/dlp v1.20.0 // indirect
 	cloud.google.com/go/iam v1.2.2 // indirect
 	cloud.google.com/go/longrunning v0.6.2 // indirect
+	cloud.google.com/go/vertexai v0.13.3 // indirect
 	github.com/apache/arrow/go/v15 v15.0.2 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
@@ -58,5 +61,8 @@ require (
 	google.golang.org/genproto v0.0.0-20241118233622-e639e219e697 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20241118233622-e639e219e697 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20241206012308-a4fef0638583 // indirect
-	google.golang.org/grpc v1.67.3 // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/minherz/aichallenges/shared => ../shared
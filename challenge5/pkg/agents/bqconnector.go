@@ -3,12 +3,15 @@ package agents
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"cloud.google.com/go/bigquery"
-	"github.com/minherz/aichallenges/challenge1/pkg/utils"
+	"github.com/minherz/aichallenges/shared/embedding"
 	"google.golang.org/api/iterator"
 )
 
+const hotelsTable = "genai_upskilling.hotels_fictional_data"
+
 type BQConnector struct {
 	client *bigquery.Client
 }
@@ -20,14 +23,8 @@ type HotelRecord struct {
 	NearAttractions string `json:"attractions"`
 }
 
-func NewBigQueryConnector(ctx context.Context) (*BQConnector, error) {
-	var err error
-	projectID := utils.GetEnvOrDefault("PROJECT_ID", utils.GetEnvOrDefault("GOOGLE_CLOUD_PROJECT", ""))
-	if projectID == "" {
-		if projectID, err = utils.ProjectID(ctx); err != nil || projectID == "" {
-			return nil, fmt.Errorf("project ID is missing: %w", err)
-		}
-	}
+// NewBigQueryConnector creates the connector to the hotels table in the project.
+func NewBigQueryConnector(ctx context.Context, projectID string) (*BQConnector, error) {
 	client, err := bigquery.NewClient(ctx, projectID)
 	if err != nil {
 		return nil, err
@@ -47,10 +44,10 @@ func (c *BQConnector) matchEmbedding(ctx context.Context, vector []float32) ([]H
 		" base.hotel_address AS hotel_address," +
 		" base.hotel_description AS hotel_description," +
 		" base.nearest_attractions AS nearest_attractions" +
-		" FROM VECTOR_SEARCH(TABLE genai_upskilling.hotels_fictional_data," +
+		" FROM VECTOR_SEARCH(TABLE " + hotelsTable + "," +
 		" 'embeddings'," +
 		" (SELECT @embeddings)," +
-		"  top_k => 5," +
+		"  top_k => " + strconv.Itoa(topK) + "," +
 		" distance_type => 'COSINE'," +
 		" options => '{\"use_brute_force\":true}');")
 	q.Parameters = []bigquery.QueryParameter{
@@ -81,3 +78,34 @@ func (c *BQConnector) matchEmbedding(ctx context.Context, vector []float32) ([]H
 	}
 	return hotels, nil
 }
+
+// indexDimensionality returns the length of the embeddings stored in the hotels table.
+// It fails if the table stores vectors of different lengths.
+func (c *BQConnector) indexDimensionality(ctx context.Context) (int, error) {
+	q := c.client.Query("SELECT DISTINCT ARRAY_LENGTH(embeddings) AS dims" +
+		" FROM " + hotelsTable +
+		" WHERE ARRAY_LENGTH(embeddings) > 0;")
+	it, err := q.Read(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var dims []int64
+	for {
+		var row []bigquery.Value
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		dims = append(dims, row[0].(int64))
+	}
+	switch len(dims) {
+	case 0:
+		return 0, fmt.Errorf("table %s has no embeddings", hotelsTable)
+	case 1:
+		return int(dims[0]), nil
+	}
+	return 0, fmt.Errorf("%w: table %s stores embeddings of different lengths %v", embedding.ErrDimensionalityMismatch, hotelsTable, dims)
+}
@@ -0,0 +1,53 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Config is the configuration of the service.
+// The generation parameters and the log level are applied without restart.
+type Config struct {
+	Server     config.Server     `yaml:"server"`
+	Model      config.Model      `yaml:"model"`
+	Generation config.Generation `yaml:"generation" hot:"true"`
+	Guardrails config.Guardrails `yaml:"guardrails"`
+	// TopicSimilarityThreshold is the minimal similarity of the message and the topic examples; 0 uses the default
+	TopicSimilarityThreshold float64          `yaml:"topic_similarity_threshold" env:"TOPIC_SIMILARITY_THRESHOLD"`
+	Embedding                config.Embedding `yaml:"embedding"`
+	// HotelsDataPath selects the in-memory hotels index instead of BigQuery when it is set
+	HotelsDataPath string `yaml:"hotels_data_path" env:"HOTELS_DATA_PATH"`
+}
+
+// DefaultConfig returns the configuration that is used when neither the configuration file
+// nor the environment variables set the values.
+func DefaultConfig() *Config {
+	server := config.DefaultServer()
+	server.LogLevel = "debug"
+	return &Config{
+		Server:     server,
+		Model:      config.Model{Backend: llm.BackendGemini, Name: "gemini-1.5-flash-001"},
+		Generation: config.Generation{Limits: config.DefaultGenerationLimits()},
+		Guardrails: config.Guardrails{
+			Redactor:        guardrails.RedactorLocal,
+			InjectionAction: guardrails.InjectionActionQuarantine,
+			TopicGuard:      guardrails.TopicGuardKeywords,
+		},
+		Embedding: config.DefaultEmbedding(),
+	}
+}
+
+func (c *Config) Validate() error {
+	errs := []error{c.Server.Validate(), c.Model.Validate(), c.Generation.Validate(), c.Guardrails.Validate(), c.Embedding.Validate()}
+	if c.TopicSimilarityThreshold < 0 || c.TopicSimilarityThreshold > 1 {
+		errs = append(errs, fmt.Errorf("topic_similarity_threshold %v is out of range [0, 1]", c.TopicSimilarityThreshold))
+	}
+	if c.Model.Backend == llm.BackendGemma && c.Model.EndpointID == "" {
+		errs = append(errs, errors.New("model.endpoint_id is required for Gemma model"))
+	}
+	return errors.Join(errs...)
+}
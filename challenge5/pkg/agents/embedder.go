@@ -0,0 +1,35 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/minherz/aichallenges/shared/embedding"
+	"github.com/minherz/aichallenges/shared/utils"
+)
+
+// NewEmbedder returns the embedder selected by the embedding configuration.
+// Vertex AI embedding models use the project and the region discovered by env.
+func NewEmbedder(ctx context.Context, c *Config, env *utils.Environment) (embedding.Embedder, error) {
+	cfg, err := c.Embedding.EmbeddingConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Provider == embedding.ProviderVertex {
+		if cfg.Region, err = env.Region(ctx); err != nil {
+			return nil, fmt.Errorf("location is missing: %w", err)
+		}
+		if cfg.ProjectID, err = env.ProjectID(ctx); err != nil {
+			return nil, fmt.Errorf("project ID is missing: %w", err)
+		}
+	}
+	return embedding.New(ctx, cfg)
+}
+
+// embeddingModelName returns the name of the configured embedding model or the provider if it has no models.
+func embeddingModelName(c *Config) string {
+	if c.Embedding.Provider != embedding.ProviderVertex {
+		return c.Embedding.Provider
+	}
+	return c.Embedding.Model
+}
@@ -0,0 +1,110 @@
+package agents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/embedding"
+)
+
+const topK = 5
+
+// HotelIndex finds hotels which embeddings match the embedding of the user query.
+type HotelIndex interface {
+	matchEmbedding(ctx context.Context, vector []float32) ([]HotelRecord, error)
+	indexDimensionality(ctx context.Context) (int, error)
+	Close()
+}
+
+// LocalHotelIndex is an in-memory stand-in for the BigQuery vector search.
+// It is loaded from the newline delimited JSON file that is used to populate the BigQuery table.
+type LocalHotelIndex struct {
+	hotels  []HotelRecord
+	vectors [][]float32
+}
+
+type hotelDataRecord struct {
+	Name            string `json:"hotel_name"`
+	Address         string `json:"hotel_address"`
+	Description     string `json:"hotel_description"`
+	NearAttractions string `json:"nearest_attractions"`
+}
+
+// NewLocalHotelIndex loads hotels from the file and embeds them as documents.
+func NewLocalHotelIndex(ctx context.Context, path string, embedder embedding.Embedder) (*LocalHotelIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hotels data: %w", err)
+	}
+	defer f.Close()
+
+	index := &LocalHotelIndex{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var r hotelDataRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid hotel record at %s:%d: %w", path, line, err)
+		}
+		// use the same content as ML.GENERATE_EMBEDDING in README
+		content := r.Description + ". Hotel is located at " + r.Address + ". Nearest attractions include " + r.NearAttractions
+		vector, err := embedder.EmbedDocument(ctx, content)
+		if err != nil {
+			return nil, fmt.Errorf("cannot embed hotel %q: %w", r.Name, err)
+		}
+		index.hotels = append(index.hotels, HotelRecord{
+			Name:            r.Name,
+			Address:         r.Address,
+			Description:     r.Description,
+			NearAttractions: r.NearAttractions,
+		})
+		index.vectors = append(index.vectors, vector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read hotels data: %w", err)
+	}
+	slog.Debug("local hotel index is loaded", slog.String("path", path), slog.Int("hotels", len(index.hotels)))
+	return index, nil
+}
+
+func (c *LocalHotelIndex) Close() {}
+
+func (c *LocalHotelIndex) indexDimensionality(_ context.Context) (int, error) {
+	if len(c.vectors) == 0 {
+		return 0, fmt.Errorf("local hotel index is empty")
+	}
+	return len(c.vectors[0]), nil
+}
+
+// matchEmbedding returns top hotels ordered by cosine distance like VECTOR_SEARCH does.
+func (c *LocalHotelIndex) matchEmbedding(_ context.Context, vector []float32) ([]HotelRecord, error) {
+	type match struct {
+		pos        int
+		similarity float64
+	}
+	matches := make([]match, 0, len(c.vectors))
+	for i, v := range c.vectors {
+		if len(v) != len(vector) {
+			return nil, fmt.Errorf("%w: index stores %d-dimensional vectors but query has %d dimensions",
+				embedding.ErrDimensionalityMismatch, len(v), len(vector))
+		}
+		matches = append(matches, match{pos: i, similarity: embedding.CosineSimilarity(v, vector)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].similarity > matches[j].similarity
+	})
+	hotels := make([]HotelRecord, 0, topK)
+	for i := 0; i < len(matches) && i < topK; i++ {
+		hotels = append(hotels, c.hotels[matches[i].pos])
+	}
+	return hotels, nil
+}
@@ -3,81 +3,221 @@ package agents
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/labstack/echo/v4"
-)
-
-const (
-	dimensionality = 768
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/embedding"
+	"github.com/minherz/aichallenges/shared/guardrails"
+	"github.com/minherz/aichallenges/shared/llm"
+	"github.com/minherz/aichallenges/shared/utils"
 )
 
 type RagAgent struct {
-	embedding *Embedding
-	model     *GenAIModel
-	connector *BQConnector
+	guards    *guardrails.Set
+	embedding embedding.Embedder
+	model     llm.Model
+	// base is model without the response logging, so the health probes do not flood the logs
+	base      llm.Model
+	connector HotelIndex
+	// embeddingModel is the name of the embedding model or the provider if it has no models
+	embeddingModel string
+	// generation is replaced when the configuration file changes
+	generation atomic.Pointer[config.Generation]
 }
 
 type RagAgentRequest struct {
 	Message string `json:"message"`
+	// GenerationParameters override the configured parameters for this request
+	config.GenerationParameters
 }
 
 type RagAgentResponse struct {
-	Error   string `json:"error,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Message is the plain text version of the response
 	Message string `json:"message,omitempty"`
+	// HTML is the sanitized response that is safe to render as HTML
+	HTML string `json:"html,omitempty"`
+	// FinishReason tells if the response was blocked or truncated
+	FinishReason llm.FinishReason `json:"finish_reason,omitempty"`
+	// Generation holds the generation parameters that were applied to the request
+	Generation *config.GenerationParameters `json:"generation,omitempty"`
 }
 
-func NewRagAgent(ctx context.Context) (agent *RagAgent, err error) {
-	embedding, err := NewEmbedding(ctx)
+// NewRagAgent creates the agent with the configuration that is validated by config.Load.
+// Google Cloud services use the project and the region discovered by env.
+func NewRagAgent(ctx context.Context, c *Config, env *utils.Environment) (_ *RagAgent, err error) {
+	agent := &RagAgent{embeddingModel: embeddingModelName(c)}
+	// release the clients that were created before the failure
+	defer func() {
+		if err != nil {
+			agent.Close()
+		}
+	}()
+	embedder, err := NewEmbedder(ctx, c, env)
 	if err != nil {
 		return nil, err
 	}
-	model, err := NewGenAIModel(ctx)
+	agent.embedding = embedder
+	model, err := newModel(ctx, c, env)
 	if err != nil {
 		return nil, err
 	}
-	connector, err := NewBigQueryConnector(ctx)
+	agent.base = model
+	// the project is discovered only for the services that need it
+	var projectID string
+	if c.HotelsDataPath == "" || c.Guardrails.Redactor == guardrails.RedactorDLP {
+		if projectID, err = env.ProjectID(ctx); err != nil {
+			return nil, fmt.Errorf("project ID is missing: %w", err)
+		}
+	}
+	if c.HotelsDataPath != "" {
+		index, err := NewLocalHotelIndex(ctx, c.HotelsDataPath, embedder)
+		if err != nil {
+			return nil, err
+		}
+		agent.connector = index
+	} else {
+		connector, err := NewBigQueryConnector(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		agent.connector = connector
+	}
+	agent.guards, err = guardrails.New(ctx, c.Guardrails, guardrails.Options{
+		ProjectID:      projectID,
+		Model:          agent.base,
+		Embed:          agent.embedding.EmbedQuery,
+		TopicThreshold: c.TopicSimilarityThreshold,
+	})
 	if err != nil {
 		return nil, err
 	}
-	agent = &RagAgent{embedding: embedding, model: model, connector: connector}
-	return
+	// the hotels are retrieved after the guardrails redacted and checked the message
+	callbacks := agent.guards.Callbacks()
+	callbacks.Before = append(callbacks.Before, agent.augment)
+	agent.model = llm.WithCallbacks(agent.base, callbacks)
+	agent.Reconfigure(c)
+	if err = agent.validateEmbeddings(ctx); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// validateEmbeddings ensures that the query embeddings can be matched against the stored ones.
+func (c *RagAgent) validateEmbeddings(ctx context.Context) error {
+	stored, err := c.checkIndex(ctx)
+	if err != nil {
+		return err
+	}
+	// probe the model to make sure it honors the configured dimensionality
+	if _, err := c.embedding.EmbedQuery(ctx, "dimensionality probe"); err != nil {
+		return fmt.Errorf("cannot validate query embeddings: %w", err)
+	}
+	slog.Debug("embeddings are validated", slog.Int("dimensionality", stored))
+	return nil
+}
+
+// checkIndex returns the dimensionality of the stored embeddings if it matches the query embeddings.
+func (c *RagAgent) checkIndex(ctx context.Context) (int, error) {
+	stored, err := c.connector.indexDimensionality(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("cannot validate stored embeddings: %w", err)
+	}
+	if stored != c.embedding.Dimensionality() {
+		return 0, fmt.Errorf("%w: index stores %d-dimensional vectors but query embedding is configured for %d dimensions",
+			embedding.ErrDimensionalityMismatch, stored, c.embedding.Dimensionality())
+	}
+	return stored, nil
+}
+
+// RegisterHealth adds the probes of the model, the embedding model and the hotels index to the health endpoints.
+func (c *RagAgent) RegisterHealth(h *utils.Health) {
+	h.SetModel("chat", c.base.Name())
+	h.SetModel("embedding", c.embeddingModel)
+	h.AddProbe("model", func(ctx context.Context) error {
+		return llm.Ping(ctx, c.base)
+	})
+	h.AddProbe("embedding", func(ctx context.Context) error {
+		_, err := c.embedding.EmbedQuery(ctx, "ping")
+		return err
+	})
+	h.AddProbe("hotels", func(ctx context.Context) error {
+		_, err := c.checkIndex(ctx)
+		return err
+	})
+}
+
+// Reconfigure applies the changed generation parameters to the next requests.
+func (c *RagAgent) Reconfigure(cfg *Config) {
+	g := cfg.Generation
+	c.generation.Store(&g)
 }
 
 func (c *RagAgent) Close() {
 	if c.embedding != nil {
 		c.embedding.Close()
 	}
-	if c.model != nil {
-		c.model.Close()
+	if c.base != nil {
+		c.base.Close()
 	}
 	if c.connector != nil {
 		c.connector.Close()
 	}
+	if c.guards != nil {
+		c.guards.Close()
+	}
 }
 
 func (c *RagAgent) Handler(ectx echo.Context) error {
 	r := &RagAgentRequest{}
-	if err := ectx.Bind(&r); err != nil {
+	if err := ectx.Bind(r); err != nil {
 		return echoError(ectx, http.StatusBadRequest, fmt.Errorf("invalid input: %w", err))
 	}
 	if r.Message == "" {
 		return echoError(ectx, http.StatusBadRequest, fmt.Errorf("request message is empty"))
 	}
-	ctx := ectx.Request().Context()
-	evector, err := c.embedding.Embed(ctx, r.Message)
+	req := llm.UserMessage(r.Message)
+	g := c.generation.Load()
+	req.Config = g.Limits.Override(g.LLMConfig(), r.GenerationParameters)
+	req.SafetySettings = c.guards.Safety
+	response, err := c.model.Generate(ectx.Request().Context(), req)
 	if err != nil {
+		if errors.Is(err, guardrails.ErrPromptInjection) {
+			return echoError(ectx, http.StatusBadRequest, guardrails.ErrPromptInjection)
+		}
 		return echoError(ectx, http.StatusInternalServerError, err)
 	}
+	slog.Debug("rag request processed", "response_length", len(response.Text), "finish_reason", response.FinishReason)
+	f := guardrails.FormatModelResponse(response)
+	return ectx.JSON(http.StatusOK, RagAgentResponse{Message: f.Text, HTML: f.HTML, FinishReason: response.FinishReason, Generation: config.Parameters(req.Config)})
+}
+
+// augment is the before model callback that adds the hotels matching the user message to the prompt.
+// It runs after the guardrails, so the message that is sent to the embedding model is redacted and checked.
+func (c *RagAgent) augment(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+	msg := req.LastUserMessage()
+	if msg == nil {
+		return nil, nil
+	}
+	evector, err := c.embedding.EmbedQuery(ctx, msg.Text)
+	if err != nil {
+		return nil, err
+	}
 	hotels, err := c.connector.matchEmbedding(ctx, evector)
 	if err != nil {
-		return echoError(ectx, http.StatusInternalServerError, err)
+		return nil, err
+	}
+	if hotels, err = c.checkHotels(ctx, hotels); err != nil {
+		return nil, err
 	}
 	prompts := []string{
-		r.Message,
+		msg.Text,
 		"Use the following list of hotels for suggestions.",
 		"Information about each hotel is JSON record with the following fields:",
 		"* name - the name of the hotel",
@@ -90,11 +230,41 @@ func (c *RagAgent) Handler(ectx echo.Context) error {
 		record, _ := json.Marshal(hotel)
 		prompts = append(prompts, string(record))
 	}
-	response, err := c.model.Inference(ctx, strings.Join(prompts, "\n"))
-	if err != nil {
-		return echoError(ectx, http.StatusInternalServerError, err)
+	msg.Text = strings.Join(prompts, "\n")
+	slog.Debug("hotels are retrieved", "session", llm.SessionFromContext(ctx), "hotels", len(hotels))
+	return nil, nil
+}
+
+// checkHotels applies the prompt injection action to the retrieved hotels and returns the hotels
+// that can be added to the prompt.
+func (c *RagAgent) checkHotels(ctx context.Context, hotels []HotelRecord) ([]HotelRecord, error) {
+	checked := hotels[:0]
+	for _, h := range hotels {
+		ok, err := c.guards.Injections.CheckFields(ctx, []*string{&h.Name, &h.Address, &h.Description, &h.NearAttractions},
+			"source", "hotel", "hotel", h.Name)
+		if err != nil {
+			return nil, fmt.Errorf("hotel %q: %w", h.Name, err)
+		}
+		if ok {
+			checked = append(checked, h)
+		}
+	}
+	return checked, nil
+}
+
+func newModel(ctx context.Context, c *Config, env *utils.Environment) (llm.Model, error) {
+	var err error
+	cfg := c.Model.LLMConfig()
+	if cfg.Backend == llm.BackendOpenAI {
+		return llm.New(ctx, cfg)
+	}
+	if cfg.Region, err = env.Region(ctx); err != nil {
+		return nil, fmt.Errorf("location is missing: %w", err)
+	}
+	if cfg.ProjectID, err = env.ProjectID(ctx); err != nil {
+		return nil, fmt.Errorf("project ID is missing: %w", err)
 	}
-	return ectx.JSON(http.StatusOK, RagAgentResponse{Message: response})
+	return llm.New(ctx, cfg)
 }
 
 func echoError(ectx echo.Context, code int, err error) error {
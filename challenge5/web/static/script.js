@@ -77,7 +77,12 @@ async function handleButtonClick() {
         console.log(responseJson);
         // refresh session Id
         sessionId = responseJson.session
-        botmessagespan.innerText = responseJson.message;
+        // html is sanitized by the server
+        if (Object.hasOwn(responseJson, 'html')) {
+            botmessagespan.innerHTML = responseJson.html;
+        } else {
+            botmessagespan.innerText = responseJson.message;
+        }
     } else {
         if (Object.hasOwn(responseJson, 'error')) {
             botmessagespan.innerText = responseJson.error;
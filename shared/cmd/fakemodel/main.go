@@ -0,0 +1,47 @@
+// Command fakemodel runs the fake model server.
+//
+// Point the services to it using VERTEX_AI_EMULATOR_HOST for Vertex AI backends
+// or OPENAI_BASE_URL for OpenAI compatible backend.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/minherz/aichallenges/shared/fake"
+)
+
+func main() {
+	grpcAddr := flag.String("grpc-addr", "localhost:8085", "address of Vertex AI gRPC API")
+	httpAddr := flag.String("http-addr", "localhost:8086", "address of OpenAI compatible HTTP API")
+	scriptPath := flag.String("script", "", "path to JSON script with rules")
+	flag.Parse()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	var script fake.Script
+	if *scriptPath != "" {
+		var err error
+		if script, err = fake.LoadScript(*scriptPath); err != nil {
+			slog.Error("cannot load script", "error", err)
+			os.Exit(1)
+		}
+	}
+	s, err := fake.NewServer(script)
+	if err != nil {
+		slog.Error("cannot create server", "error", err)
+		os.Exit(1)
+	}
+	if err := s.Listen(*grpcAddr, *httpAddr); err != nil {
+		slog.Error("cannot start server", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("fake model server is running", "grpc", s.GRPCAddr(), "openai", s.OpenAIBaseURL(), "rules", len(script.Rules))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	<-ctx.Done()
+	s.Close()
+}
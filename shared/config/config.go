@@ -0,0 +1,262 @@
+// Package config loads the typed configuration of the services from a YAML or JSON file
+// and environment variables.
+//
+// The configuration is a struct. Its fields are described with tags:
+//
+//   - yaml is the key in the file. Nested structs are nested mappings.
+//   - env is the comma separated list of environment variables that override the value. The first one that is set wins.
+//   - hot marks the fields, or the whole struct, that can be changed while the service is running (see Watch).
+//   - secret masks the value in the reports.
+//
+// The values that the caller set before calling Load are the defaults.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnvVar is the environment variable with the path of the configuration file.
+const FileEnvVar = "CONFIG_FILE"
+
+// Source tells where the value of the setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+)
+
+// Setting is the value of the configuration field and its source.
+type Setting struct {
+	// Key is the dotted path of the field in the file, e.g. "model.region"
+	Key string `json:"key"`
+	// Value is the formatted value; secrets are masked
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+	// Env is the environment variable that set the value
+	Env string `json:"env,omitempty"`
+	// Hot tells that the setting is applied without restart
+	Hot bool `json:"hot,omitempty"`
+}
+
+// Validator is implemented by the configurations that check their values after loading.
+type Validator interface {
+	Validate() error
+}
+
+// field is the leaf field of the configuration struct.
+type field struct {
+	key    string
+	env    []string
+	hot    bool
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the configuration file at path into cfg, the pointer to the struct with the default values,
+// and then overrides the values with the environment variables. An empty path skips the file.
+// It validates cfg if it implements Validator and returns the settings with their sources.
+func Load(path string, cfg any) ([]Setting, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("configuration must be a pointer to struct, got %T", cfg)
+	}
+	inFile := map[string]bool{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read configuration file: %w", err)
+		}
+		if inFile, err = decode(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+	}
+	var settings []Setting
+	for _, f := range fields(v.Elem(), "", false) {
+		s := Setting{Key: f.key, Source: SourceDefault, Hot: f.hot}
+		if inFile[f.key] {
+			s.Source = SourceFile
+		}
+		for _, name := range f.env {
+			value := os.Getenv(name)
+			if value == "" {
+				continue
+			}
+			if err := setString(f.value, value); err != nil {
+				return nil, fmt.Errorf("invalid %s value: %w", name, err)
+			}
+			s.Source, s.Env = SourceEnv, name
+			break
+		}
+		s.Value = format(f.value)
+		if f.secret && s.Value != "" {
+			s.Value = "***"
+		}
+		settings = append(settings, s)
+	}
+	if c, ok := cfg.(Validator); ok {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+	return settings, nil
+}
+
+// Log reports the settings with their sources.
+func Log(path string, settings []Setting) {
+	attrs := []any{"file", path}
+	for _, s := range settings {
+		source := string(s.Source)
+		if s.Env != "" {
+			source += " " + s.Env
+		}
+		attrs = append(attrs, s.Key, fmt.Sprintf("%s (%s)", s.Value, source))
+	}
+	slog.Info("configuration is loaded", attrs...)
+}
+
+// decode decodes the YAML or JSON data into cfg and returns the keys that are present in the data.
+// Unknown keys are reported as errors to catch typos.
+func decode(data []byte, cfg any) (map[string]bool, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	if len(root.Content) > 0 {
+		collectKeys(root.Content[0], "", keys)
+	}
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func collectKeys(n *yaml.Node, prefix string, keys map[string]bool) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := prefix + n.Content[i].Value
+		keys[key] = true
+		collectKeys(n.Content[i+1], key+".", keys)
+	}
+}
+
+// fields returns the leaf fields of the struct in the order of declaration.
+func fields(v reflect.Value, prefix string, hot bool) []field {
+	var result []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		fv := v.Field(i)
+		fhot := hot || sf.Tag.Get("hot") == "true"
+		if fv.Kind() == reflect.Struct {
+			nested := prefix + name + "."
+			if opts == "inline" {
+				nested = prefix
+			}
+			result = append(result, fields(fv, nested, fhot)...)
+			continue
+		}
+		f := field{key: prefix + name, hot: fhot, secret: sf.Tag.Get("secret") == "true", value: fv}
+		if env := sf.Tag.Get("env"); env != "" {
+			f.env = strings.Split(env, ",")
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// setString parses the value of the environment variable into the field.
+func setString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := setString(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		// any value except false ones enables the flag, e.g. DO_DEBUG=yes
+		b, err := strconv.ParseBool(s)
+		v.SetBool(err != nil || b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// format returns the value for the reports. Nil pointers are formatted as empty strings.
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = format(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Server  Server        `yaml:"server"`
+	Name    string        `yaml:"name" env:"TEST_NAME,TEST_NAME_OLD"`
+	Token   string        `yaml:"token" env:"TEST_TOKEN" secret:"true"`
+	Timeout time.Duration `yaml:"timeout" env:"TEST_TIMEOUT" hot:"true"`
+	Ratio   *float32      `yaml:"ratio" env:"TEST_RATIO"`
+	Tags    []string      `yaml:"tags" env:"TEST_TAGS"`
+	Limits  testLimits    `yaml:"limits" hot:"true"`
+	Skipped string        `yaml:"-" env:"TEST_SKIPPED"`
+}
+
+type testLimits struct {
+	Count int32 `yaml:"count" env:"TEST_COUNT"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Name == "invalid" {
+		return errors.New("name is invalid")
+	}
+	return c.Server.Validate()
+}
+
+func defaultTestConfig() *testConfig {
+	return &testConfig{Server: DefaultServer(), Name: "default", Timeout: time.Second}
+}
+
+func writeConfig(t *testing.T, dir, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func settingsByKey(settings []Setting) map[string]Setting {
+	m := map[string]Setting{}
+	for _, s := range settings {
+		m[s.Key] = s
+	}
+	return m
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+server:
+  port: "9090"
+  log_level: warn
+name: from-file
+timeout: 5s
+ratio: 0.5
+tags: [a, b]
+`)
+	t.Setenv("TEST_NAME", "")
+	t.Setenv("TEST_NAME_OLD", "from-old-env")
+	t.Setenv("TEST_TIMEOUT", "1m")
+	t.Setenv("TEST_COUNT", "7")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("PORT", "")
+
+	c := defaultTestConfig()
+	settings, err := Load(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Port != "9090" || c.Server.LogLevel != "warn" || c.Server.BodyLimit != DefaultBodyLimit {
+		t.Errorf("Server = %+v", c.Server)
+	}
+	// the second variable is used when the first one is not set
+	if c.Name != "from-old-env" {
+		t.Errorf("Name = %q, want from-old-env", c.Name)
+	}
+	if c.Timeout != time.Minute {
+		t.Errorf("Timeout = %v, want 1m", c.Timeout)
+	}
+	if c.Ratio == nil || *c.Ratio != 0.5 {
+		t.Errorf("Ratio = %v, want 0.5", c.Ratio)
+	}
+	if strings.Join(c.Tags, ",") != "a,b" || c.Limits.Count != 7 {
+		t.Errorf("Tags = %v, Limits = %+v", c.Tags, c.Limits)
+	}
+
+	got := settingsByKey(settings)
+	tests := []struct {
+		key    string
+		value  string
+		source Source
+		env    string
+		hot    bool
+	}{
+		{key: "server.port", value: "9090", source: SourceFile},
+		{key: "server.log_level", value: "warn", source: SourceFile, hot: true},
+		{key: "server.debug", value: "false", source: SourceDefault},
+		{key: "server.body_limit", value: "1048576", source: SourceDefault},
+		{key: "name", value: "from-old-env", source: SourceEnv, env: "TEST_NAME_OLD"},
+		{key: "timeout", value: "1m0s", source: SourceEnv, env: "TEST_TIMEOUT", hot: true},
+		{key: "ratio", value: "0.5", source: SourceFile},
+		{key: "tags", value: "a,b", source: SourceFile},
+		{key: "limits.count", value: "7", source: SourceEnv, env: "TEST_COUNT", hot: true},
+	}
+	for _, tc := range tests {
+		s, ok := got[tc.key]
+		if !ok {
+			t.Errorf("setting %s is missing", tc.key)
+			continue
+		}
+		want := Setting{Key: tc.key, Value: tc.value, Source: tc.source, Env: tc.env, Hot: tc.hot}
+		if s != want {
+			t.Errorf("setting %+v, want %+v", s, want)
+		}
+	}
+	if _, ok := got["skipped"]; ok {
+		t.Error("the field with yaml:\"-\" is reported")
+	}
+	if len(settings) != 11 {
+		t.Errorf("Load() returned %d settings, want 11", len(settings))
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("TEST_NAME", "from-env")
+	t.Setenv("TEST_TAGS", " rome, ,florence ")
+	t.Setenv("TEST_RATIO", "0.25")
+	c := defaultTestConfig()
+	settings, err := Load("", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "from-env" || c.Timeout != time.Second || c.Server.Port != "8080" {
+		t.Errorf("config = %+v", c)
+	}
+	if strings.Join(c.Tags, "|") != "rome|florence" {
+		t.Errorf("Tags = %q, want [rome florence]", c.Tags)
+	}
+	if c.Ratio == nil || *c.Ratio != 0.25 {
+		t.Errorf("Ratio = %v, want 0.25", c.Ratio)
+	}
+	if s := settingsByKey(settings)["timeout"]; s.Source != SourceDefault || s.Value != "1s" {
+		t.Errorf("timeout setting = %+v", s)
+	}
+	if s := settingsByKey(settings)["ratio"]; s.Source != SourceEnv {
+		t.Errorf("ratio setting = %+v", s)
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "token: file-secret\n")
+	c := defaultTestConfig()
+	settings, err := Load(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "file-secret" {
+		t.Errorf("Token = %q", c.Token)
+	}
+	if s := settingsByKey(settings)["token"]; s.Value != "***" || s.Source != SourceFile {
+		t.Errorf("token setting = %+v, want masked", s)
+	}
+
+	t.Setenv("TEST_TOKEN", "env-secret")
+	if settings, err = Load(path, defaultTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if s := settingsByKey(settings)["token"]; s.Value != "***" || s.Env != "TEST_TOKEN" {
+		t.Errorf("token setting = %+v, want masked", s)
+	}
+	for _, s := range settings {
+		if strings.Contains(s.Value, "secret") {
+			t.Errorf("setting %s reveals the secret", s.Key)
+		}
+	}
+
+	// the empty secret is reported as empty, so it is clear that it is not set
+	t.Setenv("TEST_TOKEN", "")
+	if settings, err = Load("", defaultTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if s := settingsByKey(settings)["token"]; s.Value != "" {
+		t.Errorf("token setting = %+v, want empty", s)
+	}
+}
+
+func TestLoadBool(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"true", true},
+		{"1", true},
+		{"TRUE", true},
+		{"yes", true},
+		{"on", true},
+		{"false", false},
+		{"FALSE", false},
+		{"0", false},
+		{"f", false},
+		// unset variables do not change the value
+		{"", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			t.Setenv("DO_DEBUG", tc.value)
+			c := defaultTestConfig()
+			if _, err := Load("", c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Server.Debug != tc.want {
+				t.Errorf("DO_DEBUG=%q: Debug = %v, want %v", tc.value, c.Server.Debug, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "unknown key",
+			data: "nmae: typo\n",
+			want: "field nmae not found",
+		},
+		{
+			name: "unknown nested key",
+			data: "server:\n  prot: \"9090\"\n",
+			want: "field prot not found",
+		},
+		{
+			name: "skipped key",
+			data: "skipped: x\n",
+			want: "field skipped not found",
+		},
+		{
+			name: "wrong type",
+			data: "timeout: [1]\n",
+			want: "invalid configuration file",
+		},
+		{
+			name: "invalid yaml",
+			data: "server: [\n",
+			want: "invalid configuration file",
+		},
+		{
+			name: "invalid env duration",
+			env:  map[string]string{"TEST_TIMEOUT": "5"},
+			want: "invalid TEST_TIMEOUT value",
+		},
+		{
+			name: "invalid env number",
+			env:  map[string]string{"TEST_COUNT": "many"},
+			want: "invalid TEST_COUNT value",
+		},
+		{
+			name: "validation",
+			data: "name: invalid\n",
+			want: "invalid configuration: name is invalid",
+		},
+		{
+			name: "nested validation",
+			env:  map[string]string{"LOG_LEVEL": "verbose"},
+			want: "server.log_level",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			path := writeConfig(t, t.TempDir(), tc.data)
+			_, err := Load(path, defaultTestConfig())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load() error = %v, want to contain %q", err, tc.want)
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), defaultTestConfig()); err == nil {
+		t.Error("Load() of missing file succeeded")
+	}
+	if _, err := Load("", testConfig{}); err == nil {
+		t.Error("Load() of struct value succeeded")
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `{"name": "json", "server": {"port": "9000"}, "limits": {"count": 3}}`)
+	c := defaultTestConfig()
+	if _, err := Load(path, c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "json" || c.Server.Port != "9000" || c.Limits.Count != 3 {
+		t.Errorf("config = %+v", c)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	cur, next := defaultTestConfig(), defaultTestConfig()
+	next.Timeout = time.Minute
+	next.Limits.Count = 5
+	next.Server.LogLevel = "debug"
+	next.Name = "changed"
+	next.Server.Port = "9090"
+	changed, restart := merge(cur, next)
+	if got := strings.Join(changed, ","); got != "server.log_level,timeout,limits.count" {
+		t.Errorf("changed = %s", got)
+	}
+	if got := strings.Join(restart, ","); got != "server.port,name" {
+		t.Errorf("restart = %s", got)
+	}
+	// only the hot fields are applied
+	if cur.Timeout != time.Minute || cur.Limits.Count != 5 || cur.Server.LogLevel != "debug" {
+		t.Errorf("hot fields are not applied: %+v", cur)
+	}
+	if cur.Name != "default" || cur.Server.Port != "8080" {
+		t.Errorf("restart fields are applied: %+v", cur)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "name: first\ntimeout: 2s\n")
+	current := defaultTestConfig()
+	if _, err := Load(path, current); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan *testConfig, 10)
+	Watch(ctx, path, 20*time.Millisecond, defaultTestConfig, current, func(c *testConfig) { reloaded <- c })
+
+	expect := func(want time.Duration) *testConfig {
+		t.Helper()
+		select {
+		case c := <-reloaded:
+			if c.Timeout != want {
+				t.Errorf("Timeout = %v, want %v", c.Timeout, want)
+			}
+			return c
+		case <-time.After(3 * time.Second):
+			t.Fatal("configuration is not reloaded")
+		}
+		return nil
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case c := <-reloaded:
+			t.Fatalf("unexpected reload %+v", c)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	// the hot field is applied and the restart field keeps its value
+	writeConfig(t, dir, "name: second\ntimeout: 3s\n")
+	if c := expect(3 * time.Second); c != nil && c.Name != "first" {
+		t.Errorf("Name = %q, want first", c.Name)
+	}
+	// changes of the restart fields only are not applied
+	writeConfig(t, dir, "name: third\ntimeout: 3s\n")
+	expectNone()
+	// invalid files are ignored
+	writeConfig(t, dir, "name: third\ntimeout: 4s\nunknown: 1\n")
+	expectNone()
+	writeConfig(t, dir, "name: invalid\ntimeout: 4s\n")
+	expectNone()
+	// the unchanged fields are compared with the applied configuration
+	writeConfig(t, dir, "name: fourth\ntimeout: 4s\nlimits:\n  count: 2\n")
+	if c := expect(4 * time.Second); c != nil && c.Limits.Count != 2 {
+		t.Errorf("Limits.Count = %d, want 2", c.Limits.Count)
+	}
+	// the configuration of the caller is not modified
+	if current.Timeout != 2*time.Second {
+		t.Errorf("current Timeout = %v, want 2s", current.Timeout)
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	writeConfig(t, dir, "name: fourth\ntimeout: 5s\n")
+	expectNone()
+}
+
+func TestWatchWithoutFile(t *testing.T) {
+	// the service without the configuration file has nothing to watch
+	Watch(context.Background(), "", time.Millisecond, defaultTestConfig, defaultTestConfig(), func(*testConfig) {
+		t.Error("fn is called")
+	})
+	time.Sleep(20 * time.Millisecond)
+}
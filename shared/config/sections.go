@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/embedding"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Server holds the settings of the web server.
+type Server struct {
+	Port string `yaml:"port" env:"PORT"`
+	// LogLevel is "debug", "info", "warn" or "error"
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL" hot:"true"`
+	// Debug enables request logging and debug level logs
+	Debug bool `yaml:"debug" env:"DO_DEBUG"`
+	// StaticDir is the directory with the web UI files that replace the embedded ones
+	StaticDir string `yaml:"static_dir" env:"STATIC_DIR"`
+	// BodyLimit is the size limit of the request body in bytes
+	BodyLimit int64 `yaml:"body_limit" env:"BODY_LIMIT"`
+}
+
+// DefaultBodyLimit is enough for the JSON requests of the services.
+const DefaultBodyLimit = 1 << 20
+
+// DefaultServer returns the server settings that the services used before the configuration file.
+func DefaultServer() Server {
+	return Server{Port: "8080", LogLevel: "info", BodyLimit: DefaultBodyLimit}
+}
+
+// Level returns the log level. Debug mode always uses the debug level.
+func (s Server) Level() slog.Level {
+	if s.Debug {
+		return slog.LevelDebug
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+func (s Server) Validate() error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s.LogLevel)); err != nil {
+		return fmt.Errorf("server.log_level: %w", err)
+	}
+	if s.BodyLimit <= 0 {
+		return fmt.Errorf("server.body_limit %d must be positive", s.BodyLimit)
+	}
+	return nil
+}
+
+// Model selects the model backend.
+type Model struct {
+	// Backend is "gemini", "gemma" or "openai"
+	Backend string `yaml:"backend" env:"LLM_BACKEND"`
+	// Name is the name of Gemini model
+	Name string `yaml:"name" env:"GEMINI_MODEL_NAME,GENAI_MODEL"`
+	// EndpointID is the ID of Vertex AI endpoint of the deployed Gemma model
+	EndpointID string `yaml:"endpoint_id" env:"ENDPOINT_ID"`
+	// ProjectID and Region are discovered from the metadata server when they are empty
+	ProjectID string `yaml:"project_id" env:"PROJECT_ID,GOOGLE_CLOUD_PROJECT"`
+	Region    string `yaml:"region" env:"REGION_NAME"`
+	OpenAI    OpenAI `yaml:"openai"`
+}
+
+// OpenAI holds the settings of OpenAI compatible API.
+type OpenAI struct {
+	BaseURL string `yaml:"base_url" env:"OPENAI_BASE_URL"`
+	Model   string `yaml:"model" env:"OPENAI_MODEL"`
+	APIKey  string `yaml:"api_key" env:"OPENAI_API_KEY" secret:"true"`
+}
+
+// LLMConfig returns the configuration of the model for the backend.
+func (m Model) LLMConfig() llm.Config {
+	cfg := llm.Config{Backend: m.Backend, ModelName: m.Name, EndpointID: m.EndpointID, ProjectID: m.ProjectID, Region: m.Region}
+	if m.Backend == llm.BackendOpenAI {
+		cfg.BaseURL, cfg.ModelName, cfg.APIKey = m.OpenAI.BaseURL, m.OpenAI.Model, m.OpenAI.APIKey
+	}
+	return cfg
+}
+
+func (m Model) Validate() error {
+	switch strings.ToLower(m.Backend) {
+	case llm.BackendGemini, llm.BackendGemma, llm.BackendOpenAI:
+		return nil
+	default:
+		return fmt.Errorf("model.backend: unsupported model backend %q", m.Backend)
+	}
+}
+
+// Generation holds the generation parameters. Unset parameters use the model defaults.
+type Generation struct {
+	Temperature     *float32 `yaml:"temperature" env:"TEMPERATURE"`
+	TopP            *float32 `yaml:"top_p" env:"TOP_P"`
+	TopK            *int32   `yaml:"top_k" env:"TOP_K"`
+	MaxOutputTokens *int32   `yaml:"max_output_tokens" env:"MAX_OUTPUT_TOKENS"`
+	// Limits bound the parameters that the requests set
+	Limits GenerationLimits `yaml:"limits"`
+}
+
+// GenerationLimits holds the bounds of the generation parameters that the requests set.
+type GenerationLimits struct {
+	MinTemperature float32 `yaml:"min_temperature" env:"MIN_TEMPERATURE"`
+	MaxTemperature float32 `yaml:"max_temperature" env:"MAX_TEMPERATURE"`
+	MinTopP        float32 `yaml:"min_top_p" env:"MIN_TOP_P"`
+	MaxTopP        float32 `yaml:"max_top_p" env:"MAX_TOP_P"`
+	MinTopK        int32   `yaml:"min_top_k" env:"MIN_TOP_K"`
+	MaxTopK        int32   `yaml:"max_top_k" env:"MAX_TOP_K"`
+	// MaxOutputTokens is the largest response that the requests can ask for
+	MaxOutputTokens int32 `yaml:"max_output_tokens" env:"OUTPUT_TOKENS_LIMIT"`
+}
+
+// DefaultGenerationLimits returns the bounds that allow the values that Gemini models accept.
+func DefaultGenerationLimits() GenerationLimits {
+	return GenerationLimits{
+		MaxTemperature:  2,
+		MinTopP:         0.01,
+		MaxTopP:         1,
+		MinTopK:         1,
+		MaxTopK:         40,
+		MaxOutputTokens: 8192,
+	}
+}
+
+// Override returns cfg with the parameters that are set in p. The parameters are clamped to the limits.
+func (l GenerationLimits) Override(cfg llm.GenerationConfig, p GenerationParameters) llm.GenerationConfig {
+	if p.Temperature != nil {
+		cfg.Temperature = clamp(*p.Temperature, l.MinTemperature, l.MaxTemperature)
+	}
+	if p.TopP != nil {
+		cfg.TopP = clamp(*p.TopP, l.MinTopP, l.MaxTopP)
+	}
+	if p.TopK != nil {
+		cfg.TopK = clamp(*p.TopK, l.MinTopK, l.MaxTopK)
+	}
+	if p.MaxOutputTokens != nil {
+		cfg.MaxOutputTokens = clamp(*p.MaxOutputTokens, 1, l.MaxOutputTokens)
+	}
+	return cfg
+}
+
+func (l GenerationLimits) Validate() error {
+	var errs []error
+	if l.MinTemperature < 0 || l.MinTemperature > l.MaxTemperature || l.MaxTemperature > 2 {
+		errs = append(errs, fmt.Errorf("generation.limits: temperature bounds [%v, %v] are out of range [0, 2]", l.MinTemperature, l.MaxTemperature))
+	}
+	if l.MinTopP <= 0 || l.MinTopP > l.MaxTopP || l.MaxTopP > 1 {
+		errs = append(errs, fmt.Errorf("generation.limits: top_p bounds [%v, %v] are out of range (0, 1]", l.MinTopP, l.MaxTopP))
+	}
+	if l.MinTopK <= 0 || l.MinTopK > l.MaxTopK {
+		errs = append(errs, fmt.Errorf("generation.limits: top_k bounds [%d, %d] are invalid", l.MinTopK, l.MaxTopK))
+	}
+	if l.MaxOutputTokens <= 0 {
+		errs = append(errs, fmt.Errorf("generation.limits.max_output_tokens %d must be positive", l.MaxOutputTokens))
+	}
+	return errors.Join(errs...)
+}
+
+// GenerationParameters are the generation parameters that the API requests set and the responses echo.
+type GenerationParameters struct {
+	Temperature     *float32 `json:"temperature,omitempty" form:"temperature"`
+	TopP            *float32 `json:"top_p,omitempty" form:"top_p"`
+	TopK            *int32   `json:"top_k,omitempty" form:"top_k"`
+	MaxOutputTokens *int32   `json:"max_output_tokens,omitempty" form:"max_output_tokens"`
+}
+
+// Parameters returns the parameters of the generation config or nil if none is set.
+func Parameters(cfg llm.GenerationConfig) *GenerationParameters {
+	if cfg.Temperature == nil && cfg.TopP == nil && cfg.TopK == nil && cfg.MaxOutputTokens == nil {
+		return nil
+	}
+	return &GenerationParameters{Temperature: cfg.Temperature, TopP: cfg.TopP, TopK: cfg.TopK, MaxOutputTokens: cfg.MaxOutputTokens}
+}
+
+func clamp[T float32 | int32](v, lo, hi T) *T {
+	if v < lo {
+		v = lo
+	}
+	if v > hi {
+		v = hi
+	}
+	return &v
+}
+
+// LLMConfig returns the generation config of the model requests.
+func (g Generation) LLMConfig() llm.GenerationConfig {
+	return llm.GenerationConfig{Temperature: g.Temperature, TopP: g.TopP, TopK: g.TopK, MaxOutputTokens: g.MaxOutputTokens}
+}
+
+func (g Generation) Validate() error {
+	var errs []error
+	if g.Temperature != nil && (*g.Temperature < 0 || *g.Temperature > 2) {
+		errs = append(errs, fmt.Errorf("generation.temperature %v is out of range [0, 2]", *g.Temperature))
+	}
+	if g.TopP != nil && (*g.TopP <= 0 || *g.TopP > 1) {
+		errs = append(errs, fmt.Errorf("generation.top_p %v is out of range (0, 1]", *g.TopP))
+	}
+	if g.TopK != nil && *g.TopK <= 0 {
+		errs = append(errs, fmt.Errorf("generation.top_k %d must be positive", *g.TopK))
+	}
+	if g.MaxOutputTokens != nil && *g.MaxOutputTokens <= 0 {
+		errs = append(errs, fmt.Errorf("generation.max_output_tokens %d must be positive", *g.MaxOutputTokens))
+	}
+	errs = append(errs, g.Limits.Validate())
+	return errors.Join(errs...)
+}
+
+// Guardrails holds the settings of the checks of prompts and responses.
+type Guardrails struct {
+	// Redactor is "local", "dlp" or "none"
+	Redactor string `yaml:"pii_redactor" env:"PII_REDACTOR"`
+	// InjectionAction is "block", "quarantine", "strip" or "none"
+	InjectionAction     string `yaml:"injection_action" env:"INJECTION_ACTION"`
+	InjectionClassifier bool   `yaml:"injection_classifier" env:"INJECTION_CLASSIFIER"`
+	// TopicGuard is "keywords", "embedding", "model" or "none"
+	TopicGuard    string   `yaml:"topic_guard" env:"TOPIC_GUARD"`
+	TopicKeywords []string `yaml:"topic_keywords" env:"TOPIC_KEYWORDS"`
+	TopicRefusal  string   `yaml:"topic_refusal_message" env:"TOPIC_REFUSAL_MESSAGE"`
+	// SafetySettings is the comma separated list of category=threshold pairs
+	SafetySettings string `yaml:"safety_settings" env:"SAFETY_SETTINGS"`
+}
+
+// Safety returns the parsed safety settings.
+func (g Guardrails) Safety() ([]llm.SafetySetting, error) {
+	return llm.ParseSafetySettings(g.SafetySettings)
+}
+
+func (g Guardrails) Validate() error {
+	if _, err := g.Safety(); err != nil {
+		return fmt.Errorf("guardrails.safety_settings: %w", err)
+	}
+	return nil
+}
+
+// Embedding selects the embedding model.
+type Embedding struct {
+	// Provider is "vertex" or "local"
+	Provider       string `yaml:"provider" env:"EMBEDDING_PROVIDER"`
+	Model          string `yaml:"model" env:"EMBEDDING_MODEL"`
+	QueryTask      string `yaml:"query_task" env:"EMBEDDING_QUERY_TASK"`
+	DocumentTask   string `yaml:"document_task" env:"EMBEDDING_DOCUMENT_TASK"`
+	Dimensionality int    `yaml:"dimensionality" env:"EMBEDDING_DIMENSIONALITY"`
+}
+
+// DefaultEmbedding returns the settings of the default Vertex AI embedding model.
+func DefaultEmbedding() Embedding {
+	return Embedding{
+		Provider:       embedding.ProviderVertex,
+		Model:          embedding.DefaultModel,
+		QueryTask:      string(embedding.TaskRetrievalQuery),
+		DocumentTask:   string(embedding.TaskRetrievalDocument),
+		Dimensionality: embedding.DefaultDimensionality,
+	}
+}
+
+// EmbeddingConfig returns the configuration of the embedder. ProjectID and Region have to be set by the caller.
+func (e Embedding) EmbeddingConfig() (embedding.Config, error) {
+	queryTask, err := embedding.ParseTaskType(e.QueryTask)
+	if err != nil {
+		return embedding.Config{}, err
+	}
+	documentTask, err := embedding.ParseTaskType(e.DocumentTask)
+	if err != nil {
+		return embedding.Config{}, err
+	}
+	return embedding.Config{
+		Provider:       e.Provider,
+		Model:          e.Model,
+		QueryTask:      queryTask,
+		DocumentTask:   documentTask,
+		Dimensionality: e.Dimensionality,
+	}, nil
+}
+
+func (e Embedding) Validate() error {
+	if _, err := e.EmbeddingConfig(); err != nil {
+		return fmt.Errorf("embedding: %w", err)
+	}
+	if e.Dimensionality <= 0 {
+		return fmt.Errorf("embedding.dimensionality %d must be positive", e.Dimensionality)
+	}
+	return nil
+}
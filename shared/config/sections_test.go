@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestGenerationLimitsOverride(t *testing.T) {
+	configured := llm.GenerationConfig{Temperature: ptr[float32](0.7), TopK: ptr[int32](10)}
+	tests := []struct {
+		name   string
+		params GenerationParameters
+		want   GenerationParameters
+	}{
+		{
+			name: "no overrides",
+			want: GenerationParameters{Temperature: ptr[float32](0.7), TopK: ptr[int32](10)},
+		},
+		{
+			name:   "in range",
+			params: GenerationParameters{Temperature: ptr[float32](1.5), TopP: ptr[float32](0.9), TopK: ptr[int32](20), MaxOutputTokens: ptr[int32](512)},
+			want:   GenerationParameters{Temperature: ptr[float32](1.5), TopP: ptr[float32](0.9), TopK: ptr[int32](20), MaxOutputTokens: ptr[int32](512)},
+		},
+		{
+			name:   "above the limits",
+			params: GenerationParameters{Temperature: ptr[float32](3), TopP: ptr[float32](1.5), TopK: ptr[int32](100), MaxOutputTokens: ptr[int32](100000)},
+			want:   GenerationParameters{Temperature: ptr[float32](2), TopP: ptr[float32](1), TopK: ptr[int32](40), MaxOutputTokens: ptr[int32](8192)},
+		},
+		{
+			name:   "below the limits",
+			params: GenerationParameters{Temperature: ptr[float32](-1), TopP: ptr[float32](0), TopK: ptr[int32](0), MaxOutputTokens: ptr[int32](-5)},
+			want:   GenerationParameters{Temperature: ptr[float32](0), TopP: ptr[float32](0.01), TopK: ptr[int32](1), MaxOutputTokens: ptr[int32](1)},
+		},
+		{
+			name:   "partial override",
+			params: GenerationParameters{TopP: ptr[float32](0.5)},
+			want:   GenerationParameters{Temperature: ptr[float32](0.7), TopP: ptr[float32](0.5), TopK: ptr[int32](10)},
+		},
+	}
+	limits := DefaultGenerationLimits()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := configured
+			got := Parameters(limits.Override(cfg, tc.params))
+			if got == nil || !equalParameters(*got, tc.want) {
+				t.Errorf("Override() = %s, want %s", formatParameters(got), formatParameters(&tc.want))
+			}
+			// the configured parameters are not changed
+			if *configured.Temperature != 0.7 || *configured.TopK != 10 || configured.TopP != nil {
+				t.Errorf("configured parameters are changed: %+v", configured)
+			}
+		})
+	}
+}
+
+func TestGenerationLimitsOverrideCustom(t *testing.T) {
+	limits := GenerationLimits{MinTemperature: 0.2, MaxTemperature: 0.8, MinTopP: 0.5, MaxTopP: 0.9, MinTopK: 5, MaxTopK: 10, MaxOutputTokens: 256}
+	if err := limits.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	got := Parameters(limits.Override(llm.GenerationConfig{}, GenerationParameters{
+		Temperature:     ptr[float32](0.1),
+		TopP:            ptr[float32](0.95),
+		TopK:            ptr[int32](3),
+		MaxOutputTokens: ptr[int32](1024),
+	}))
+	want := GenerationParameters{Temperature: ptr[float32](0.2), TopP: ptr[float32](0.9), TopK: ptr[int32](5), MaxOutputTokens: ptr[int32](256)}
+	if got == nil || !equalParameters(*got, want) {
+		t.Errorf("Override() = %s, want %s", formatParameters(got), formatParameters(&want))
+	}
+}
+
+func TestParameters(t *testing.T) {
+	if p := Parameters(llm.GenerationConfig{ResponseMIMEType: llm.MIMETypeJSON}); p != nil {
+		t.Errorf("Parameters() of the default config = %s, want nil", formatParameters(p))
+	}
+	p := Parameters(llm.GenerationConfig{MaxOutputTokens: ptr[int32](100)})
+	if p == nil || p.MaxOutputTokens == nil || *p.MaxOutputTokens != 100 || p.Temperature != nil {
+		t.Errorf("Parameters() = %s, want max_output_tokens 100", formatParameters(p))
+	}
+}
+
+func TestGenerationValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		g    Generation
+		want string
+	}{
+		{name: "defaults", g: Generation{Limits: DefaultGenerationLimits()}},
+		{name: "temperature", g: Generation{Temperature: ptr[float32](2.5), Limits: DefaultGenerationLimits()}, want: "generation.temperature"},
+		{name: "top_p", g: Generation{TopP: ptr[float32](0), Limits: DefaultGenerationLimits()}, want: "generation.top_p"},
+		{name: "top_k", g: Generation{TopK: ptr[int32](0), Limits: DefaultGenerationLimits()}, want: "generation.top_k"},
+		{name: "max_output_tokens", g: Generation{MaxOutputTokens: ptr[int32](-1), Limits: DefaultGenerationLimits()}, want: "generation.max_output_tokens"},
+		{name: "no limits", g: Generation{}, want: "generation.limits"},
+		{
+			name: "inverted temperature bounds",
+			g:    Generation{Limits: GenerationLimits{MinTemperature: 1, MaxTemperature: 0.5, MinTopP: 0.1, MaxTopP: 1, MinTopK: 1, MaxTopK: 1, MaxOutputTokens: 1}},
+			want: "temperature bounds [1, 0.5]",
+		},
+		{
+			name: "top_p bound above 1",
+			g:    Generation{Limits: GenerationLimits{MaxTemperature: 1, MinTopP: 0.1, MaxTopP: 2, MinTopK: 1, MaxTopK: 1, MaxOutputTokens: 1}},
+			want: "top_p bounds [0.1, 2]",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.g.Validate()
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate() = %v, want to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadGenerationLimits(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "temperature: 0.4\nlimits:\n  max_temperature: 1\n  max_output_tokens: 1024\n")
+	t.Setenv("MAX_TOP_K", "20")
+	g := &Generation{Limits: DefaultGenerationLimits()}
+	if _, err := Load(path, g); err != nil {
+		t.Fatal(err)
+	}
+	got := Parameters(g.Limits.Override(g.LLMConfig(), GenerationParameters{Temperature: ptr[float32](1.8), TopK: ptr[int32](30), MaxOutputTokens: ptr[int32](2048)}))
+	want := GenerationParameters{Temperature: ptr[float32](1), TopK: ptr[int32](20), MaxOutputTokens: ptr[int32](1024)}
+	if got == nil || !equalParameters(*got, want) {
+		t.Errorf("Override() = %s, want %s", formatParameters(got), formatParameters(&want))
+	}
+	// the unset limits keep the defaults
+	if g.Limits.MinTopP != 0.01 || g.Limits.MaxTopP != 1 {
+		t.Errorf("Limits = %+v", g.Limits)
+	}
+}
+
+func equalParameters(a, b GenerationParameters) bool {
+	return equalPtr(a.Temperature, b.Temperature) && equalPtr(a.TopP, b.TopP) &&
+		equalPtr(a.TopK, b.TopK) && equalPtr(a.MaxOutputTokens, b.MaxOutputTokens)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatParameters(p *GenerationParameters) string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+)
+
+// DefaultWatchInterval is the interval of checking the configuration file for changes.
+const DefaultWatchInterval = 5 * time.Second
+
+// Watch checks the configuration file every interval and, when it changes, loads it into the configuration
+// returned by defaults. The fields tagged with `hot:"true"` are copied to the copy of current and fn is called
+// with it if any of them changed. Changes of other fields are logged and take effect after restart.
+// Invalid files are logged and ignored. Watch returns immediately and stops when ctx is done.
+func Watch[T any](ctx context.Context, path string, interval time.Duration, defaults func() *T, current *T, fn func(*T)) {
+	if path == "" {
+		return
+	}
+	last, _ := os.Stat(path)
+	cur := *current
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				slog.Error("cannot access configuration file. continue watching", "error", err, "path", path)
+				continue
+			}
+			if last != nil && fi.Size() == last.Size() && fi.ModTime().Equal(last.ModTime()) && os.SameFile(fi, last) {
+				continue
+			}
+			last = fi
+			next := defaults()
+			if _, err := Load(path, next); err != nil {
+				slog.Error("configuration is not reloaded", "error", err, "path", path)
+				continue
+			}
+			changed, restart := merge(&cur, next)
+			if len(restart) > 0 {
+				slog.Warn("configuration changes require restart", "keys", restart)
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			slog.Info("configuration is reloaded", "keys", changed)
+			c := cur
+			fn(&c)
+		}
+	}()
+}
+
+// merge copies the changed hot fields of next to cur and returns the keys of the changed fields
+// and of the changed fields that cannot be applied without restart.
+func merge[T any](cur, next *T) (changed, restart []string) {
+	to := fields(reflect.ValueOf(cur).Elem(), "", false)
+	from := fields(reflect.ValueOf(next).Elem(), "", false)
+	for i, f := range to {
+		if reflect.DeepEqual(f.value.Interface(), from[i].value.Interface()) {
+			continue
+		}
+		if !f.hot {
+			restart = append(restart, f.key)
+			continue
+		}
+		f.value.Set(from[i].value)
+		changed = append(changed, f.key)
+	}
+	return changed, restart
+}
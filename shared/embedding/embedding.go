@@ -0,0 +1,104 @@
+// Package embedding converts text into vectors using Vertex AI embedding models
+// or a local stand-in that works without network access.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/llm"
+	"google.golang.org/api/option"
+)
+
+const (
+	ProviderVertex = "vertex"
+	ProviderLocal  = "local"
+
+	DefaultModel          = "text-embedding-004"
+	DefaultDimensionality = 768
+)
+
+// TaskType is the intended downstream application of the embedding.
+// See https://cloud.google.com/vertex-ai/generative-ai/docs/embeddings/task-types
+type TaskType string
+
+const (
+	TaskRetrievalQuery     TaskType = "RETRIEVAL_QUERY"
+	TaskRetrievalDocument  TaskType = "RETRIEVAL_DOCUMENT"
+	TaskSemanticSimilarity TaskType = "SEMANTIC_SIMILARITY"
+	TaskClassification     TaskType = "CLASSIFICATION"
+	TaskClustering         TaskType = "CLUSTERING"
+	TaskQuestionAnswering  TaskType = "QUESTION_ANSWERING"
+	TaskFactVerification   TaskType = "FACT_VERIFICATION"
+)
+
+// ErrDimensionalityMismatch is returned when vectors produced by the embedding model
+// cannot be compared with the vectors stored in the index.
+var ErrDimensionalityMismatch = errors.New("embedding dimensionality mismatch")
+
+// ParseTaskType returns the task type or the error if v is not one of the supported task types.
+func ParseTaskType(v string) (TaskType, error) {
+	switch t := TaskType(v); t {
+	case TaskRetrievalQuery, TaskRetrievalDocument, TaskSemanticSimilarity, TaskClassification,
+		TaskClustering, TaskQuestionAnswering, TaskFactVerification:
+		return t, nil
+	}
+	return "", fmt.Errorf("unsupported embedding task type %q", v)
+}
+
+// Embedder converts text into vectors that can be matched against the index.
+type Embedder interface {
+	EmbedQuery(ctx context.Context, input string) ([]float32, error)
+	EmbedDocument(ctx context.Context, input string) ([]float32, error)
+	Dimensionality() int
+	Close()
+}
+
+// Config selects the embedding provider and holds the settings of Vertex AI embedding model.
+// Zero values are replaced with defaults.
+type Config struct {
+	Provider       string
+	ProjectID      string
+	Region         string
+	Model          string
+	QueryTask      TaskType
+	DocumentTask   TaskType
+	Dimensionality int
+	ClientOptions  []option.ClientOption
+}
+
+// New returns the embedder of the configured provider.
+func New(ctx context.Context, cfg Config) (Embedder, error) {
+	if cfg.Dimensionality < 0 {
+		return nil, fmt.Errorf("invalid embedding dimensionality: %d", cfg.Dimensionality)
+	}
+	if cfg.Dimensionality == 0 {
+		cfg.Dimensionality = DefaultDimensionality
+	}
+	switch provider := strings.ToLower(cfg.Provider); provider {
+	case ProviderVertex, "":
+		cfg.ClientOptions = append(cfg.ClientOptions, llm.EmulatorOptions()...)
+		return NewVertex(ctx, cfg)
+	case ProviderLocal:
+		return NewLocal(cfg.Dimensionality), nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider %q", provider)
+	}
+}
+
+// CosineSimilarity returns the cosine of the angle between the vectors of the same length.
+func CosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
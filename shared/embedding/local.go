@@ -0,0 +1,77 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Local is a deterministic stand-in for the Vertex AI embedding model.
+// It hashes words, word pairs and character trigrams into a vector of the configured
+// dimensionality. It does not capture semantics but similar texts get similar vectors,
+// which is sufficient to run the services without network access.
+type Local struct {
+	dimensionality int
+}
+
+func NewLocal(dimensionality int) *Local {
+	if dimensionality <= 0 {
+		dimensionality = DefaultDimensionality
+	}
+	return &Local{dimensionality: dimensionality}
+}
+
+func (e *Local) Close() {}
+
+func (e *Local) Dimensionality() int {
+	return e.dimensionality
+}
+
+func (e *Local) EmbedQuery(_ context.Context, input string) ([]float32, error) {
+	return e.embed(input), nil
+}
+
+func (e *Local) EmbedDocument(_ context.Context, input string) ([]float32, error) {
+	return e.embed(input), nil
+}
+
+func (e *Local) embed(input string) []float32 {
+	vector := make([]float32, e.dimensionality)
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		e.add(vector, "w:"+word, 1)
+		if i > 0 {
+			e.add(vector, "b:"+words[i-1]+" "+word, 0.5)
+		}
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			e.add(vector, "c:"+string(padded[j:j+3]), 0.25)
+		}
+	}
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector
+}
+
+// add uses the hashing trick: the feature hash selects the dimension and the sign.
+func (e *Local) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[sum%uint64(len(vector))] += weight
+}
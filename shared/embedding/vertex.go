@@ -0,0 +1,120 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Vertex calls Vertex AI text embedding model.
+type Vertex struct {
+	client         *aiplatform.PredictionClient
+	endpoint       string
+	model          string
+	queryTask      TaskType
+	documentTask   TaskType
+	dimensionality int
+}
+
+// NewVertex creates the prediction client for cfg.Model in cfg.Region.
+func NewVertex(ctx context.Context, cfg Config) (*Vertex, error) {
+	if cfg.ProjectID == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("vertex embedding requires project and region")
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.QueryTask == "" {
+		cfg.QueryTask = TaskRetrievalQuery
+	}
+	if cfg.DocumentTask == "" {
+		cfg.DocumentTask = TaskRetrievalDocument
+	}
+	if cfg.Dimensionality == 0 {
+		cfg.Dimensionality = DefaultDimensionality
+	}
+	opts := append([]option.ClientOption{option.WithEndpoint(fmt.Sprintf("%s-aiplatform.googleapis.com:443", cfg.Region))}, cfg.ClientOptions...)
+	client, err := aiplatform.NewPredictionClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", cfg.ProjectID, cfg.Region, cfg.Model)
+	slog.Debug("embedding is initialized",
+		slog.String("endpoint", endpoint),
+		slog.String("query_task", string(cfg.QueryTask)),
+		slog.String("document_task", string(cfg.DocumentTask)),
+		slog.Int("dimensionality", cfg.Dimensionality))
+	return &Vertex{
+		client:         client,
+		endpoint:       endpoint,
+		model:          cfg.Model,
+		queryTask:      cfg.QueryTask,
+		documentTask:   cfg.DocumentTask,
+		dimensionality: cfg.Dimensionality,
+	}, nil
+}
+
+func (e *Vertex) Close() {
+	if e.client != nil {
+		e.client.Close()
+	}
+}
+
+// Dimensionality returns the length of the vectors produced by the embedding.
+func (e *Vertex) Dimensionality() int {
+	return e.dimensionality
+}
+
+// EmbedQuery returns the embedding of the user query that is used to search the index.
+func (e *Vertex) EmbedQuery(ctx context.Context, input string) ([]float32, error) {
+	return e.embed(ctx, input, e.queryTask)
+}
+
+// EmbedDocument returns the embedding of the document that is stored in the index.
+func (e *Vertex) EmbedDocument(ctx context.Context, input string) ([]float32, error) {
+	return e.embed(ctx, input, e.documentTask)
+}
+
+func (e *Vertex) embed(ctx context.Context, input string, task TaskType) ([]float32, error) {
+	var vector []float32
+
+	instances := []*structpb.Value{
+		structpb.NewStructValue(&structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"content":   structpb.NewStringValue(input),
+				"task_type": structpb.NewStringValue(string(task)),
+			},
+		}),
+	}
+	params := structpb.NewStructValue(&structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"outputDimensionality": structpb.NewNumberValue(float64(e.dimensionality)),
+		},
+	})
+	req := &aiplatformpb.PredictRequest{
+		Endpoint:   e.endpoint,
+		Instances:  instances,
+		Parameters: params,
+	}
+	resp, err := e.client.Predict(ctx, req)
+	if err != nil {
+		return vector, err
+	}
+	if len(resp.Predictions) != 1 {
+		return vector, fmt.Errorf("unexpected number of embeddings")
+	}
+	values := resp.Predictions[0].GetStructValue().Fields["embeddings"].GetStructValue().Fields["values"].GetListValue().Values
+	if len(values) != e.dimensionality {
+		return vector, fmt.Errorf("%w: model %q returned %d values instead of %d", ErrDimensionalityMismatch, e.model, len(values), e.dimensionality)
+	}
+	vector = make([]float32, len(values))
+	for i, value := range values {
+		vector[i] = float32(value.GetNumberValue())
+	}
+	return vector, nil
+}
@@ -0,0 +1,148 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Stream bool `json:"stream"`
+}
+
+// HTTPHandler returns the handler of OpenAI compatible chat completions API.
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.chatCompletions)
+	return mux
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeChatError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeChatError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec := Request{Method: MethodChat, Endpoint: req.Model, Turns: len(req.Messages)}
+	var promptTokens int32
+	for _, m := range req.Messages {
+		promptTokens += tokens(m.Content)
+		switch m.Role {
+		case "system":
+			rec.SystemInstruction = m.Content
+			rec.Turns--
+		case "user":
+			rec.Prompt = m.Content
+		}
+	}
+	rule, err := s.match(rec)
+	if err == nil && (rule.Error != nil || !req.Stream) {
+		err = respond(r.Context(), rule)
+	}
+	if err != nil {
+		st := status.Convert(err)
+		writeChatError(w, httpStatus(st.Code()), st.Message())
+		return
+	}
+	usage := map[string]int32{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": tokens(rule.Response),
+		"total_tokens":      promptTokens + tokens(rule.Response),
+	}
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"object": "chat.completion",
+			"model":  req.Model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": rule.Response},
+				"finish_reason": openAIFinishReason(rule),
+			}},
+			"usage": usage,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range chunks(rule) {
+		if err := wait(r.Context(), time.Duration(rule.Latency)); err != nil {
+			return
+		}
+		writeEvent(w, map[string]any{
+			"object":  "chat.completion.chunk",
+			"model":   req.Model,
+			"choices": []map[string]any{{"index": 0, "delta": map[string]string{"content": chunk}}},
+		})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	writeEvent(w, map[string]any{
+		"object":  "chat.completion.chunk",
+		"model":   req.Model,
+		"choices": []map[string]any{{"index": 0, "delta": map[string]string{}, "finish_reason": openAIFinishReason(rule)}},
+	})
+	writeEvent(w, map[string]any{"object": "chat.completion.chunk", "model": req.Model, "choices": []any{}, "usage": usage})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func writeEvent(w http.ResponseWriter, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func writeChatError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": msg}})
+}
+
+// openAIFinishReason converts the Gemini finish and block reasons of the rule.
+func openAIFinishReason(rule Rule) string {
+	if rule.BlockReason != "" {
+		return "content_filter"
+	}
+	switch rule.FinishReason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func httpStatus(c codes.Code) int {
+	switch c {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded, codes.Canceled:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,115 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Methods that a rule can be restricted to.
+const (
+	MethodPredict  = "predict"
+	MethodGenerate = "generate"
+	MethodStream   = "stream"
+	MethodEmbed    = "embed"
+	MethodChat     = "chat"
+)
+
+// Duration is time.Duration that is read from JSON strings like "250ms".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Error describes the error the server returns instead of the response.
+type Error struct {
+	// Code is gRPC code, e.g. "UNAVAILABLE". It is converted to HTTP status for OpenAI API.
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// Rule describes how the server responds to the matching request.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Method restricts the rule to one of the methods. The rule matches all methods if empty.
+	Method string `json:"method,omitempty"`
+	// Pattern is a regular expression that is matched against the prompt.
+	// The rule matches all prompts if empty.
+	Pattern string `json:"pattern,omitempty"`
+	// Response is the text of the model response.
+	Response string `json:"response,omitempty"`
+	// Chunks are returned one by one for streaming methods. Response is split into words if empty.
+	Chunks []string `json:"chunks,omitempty"`
+	// FinishReason is the Gemini finish reason, e.g. "SAFETY" or "MAX_TOKENS". Defaults to "STOP".
+	FinishReason string `json:"finish_reason,omitempty"`
+	// BlockReason is the Gemini prompt block reason, e.g. "SAFETY". The blocked response has no candidates.
+	BlockReason string `json:"block_reason,omitempty"`
+	// Latency delays the response or each chunk of the stream.
+	Latency Duration `json:"latency,omitempty"`
+	Error   *Error   `json:"error,omitempty"`
+	// Times limits the number of requests the rule matches. Zero means unlimited.
+	Times int `json:"times,omitempty"`
+
+	re   *regexp.Regexp
+	hits int
+}
+
+// Script is the ordered list of rules. The first matching rule is used.
+type Script struct {
+	Rules []Rule `json:"rules"`
+	// Dimensionality of the embeddings when the request does not specify it. Defaults to 768.
+	Dimensionality int `json:"dimensionality,omitempty"`
+}
+
+// LoadScript reads the script from JSON file.
+func LoadScript(path string) (Script, error) {
+	var s Script
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid script %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern of rule %q: %w", r.Name, err)
+	}
+	r.re = re
+	return nil
+}
+
+func (r *Rule) matches(method, prompt string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if r.Times > 0 && r.hits >= r.Times {
+		return false
+	}
+	return r.re == nil || r.re.MatchString(prompt)
+}
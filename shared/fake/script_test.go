@@ -0,0 +1,83 @@
+package fake
+
+import (
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		method string
+		prompt string
+		want   bool
+	}{
+		{"empty rule matches all", Rule{}, MethodGenerate, "anything", true},
+		{"method matches", Rule{Method: MethodChat}, MethodChat, "hi", true},
+		{"method differs", Rule{Method: MethodChat}, MethodPredict, "hi", false},
+		{"pattern matches", Rule{Pattern: `(?i)rome`}, MethodGenerate, "Plan a trip to Rome", true},
+		{"pattern differs", Rule{Pattern: `(?i)rome`}, MethodGenerate, "Plan a trip to Paris", false},
+		{"method and pattern", Rule{Method: MethodStream, Pattern: `^plan`}, MethodStream, "plan a trip", true},
+		{"times not reached", Rule{Times: 2, hits: 1}, MethodGenerate, "hi", true},
+		{"times reached", Rule{Times: 2, hits: 2}, MethodGenerate, "hi", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rule.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := tc.rule.matches(tc.method, tc.prompt); got != tc.want {
+				t.Errorf("matches(%q, %q) = %v, want %v", tc.method, tc.prompt, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRuleInvalidPattern(t *testing.T) {
+	if _, err := NewServer(Script{Rules: []Rule{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Error("NewServer() with invalid pattern succeeded")
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	s, err := NewServer(Script{Rules: []Rule{
+		{Name: "once", Pattern: "hotel", Times: 1},
+		{Name: "hotel", Pattern: "hotel"},
+		{Name: "default"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, prompt := range []string{"hotel", "hotel", "museum"} {
+		rule, err := s.match(Request{Method: MethodGenerate, Prompt: prompt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rule.Name)
+	}
+	want := []string{"once", "hotel", "default"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("matched rules = %v, want %v", got, want)
+		}
+	}
+	s.Reset()
+	if rule, _ := s.match(Request{Method: MethodGenerate, Prompt: "hotel"}); rule.Name != "once" {
+		t.Errorf("matched rule after Reset() = %q, want %q", rule.Name, "once")
+	}
+}
+
+func TestMatchNoRule(t *testing.T) {
+	s, err := NewServer(Script{Rules: []Rule{{Method: MethodChat}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.match(Request{Method: MethodGenerate, Prompt: "hi"}); err == nil {
+		t.Error("match() without matching rule succeeded")
+	}
+	// embeddings do not need rules
+	if _, err := s.match(Request{Method: MethodEmbed, Prompt: "hi"}); err != nil {
+		t.Errorf("match() of embedding request failed: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package fake implements a scriptable model server that replaces Vertex AI
+// and OpenAI compatible servers in tests and local development.
+//
+// The server implements Predict (Gemma endpoints and embedding models) of
+// Vertex AI v1 API, GenerateContent and StreamGenerateContent of v1beta1 API
+// that is used by Gemini SDK, and OpenAI chat completions over HTTP.
+// Responses are selected by the rules of the script and all requests are recorded.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minherz/aichallenges/shared/llm"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultDimensionality = 768
+
+// Request is the recorded request to the server.
+type Request struct {
+	Time   time.Time
+	Method string
+	// Endpoint is the Vertex AI endpoint or the model name.
+	Endpoint          string
+	Prompt            string
+	SystemInstruction string
+	// Turns is the number of messages in the conversation including the prompt.
+	Turns int
+	// Blobs are MIME types of the inline data in the conversation.
+	Blobs []string
+	// Rule is the name of the matched rule.
+	Rule string
+}
+
+// Server is the fake model server.
+type Server struct {
+	mu             sync.Mutex
+	rules          []*Rule
+	requests       []Request
+	dimensionality int
+
+	grpcServer *grpc.Server
+	grpcLis    net.Listener
+	httpServer *http.Server
+	httpLis    net.Listener
+}
+
+// NewServer returns the server that responds using the script.
+func NewServer(script Script) (*Server, error) {
+	s := &Server{dimensionality: script.Dimensionality}
+	if s.dimensionality <= 0 {
+		s.dimensionality = defaultDimensionality
+	}
+	for _, r := range script.Rules {
+		if err := s.AddRule(r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddRule appends the rule to the script.
+func (s *Server) AddRule(r Rule) error {
+	if err := r.compile(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &r)
+	return nil
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Reset forgets recorded requests and rule hits.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	for _, r := range s.rules {
+		r.hits = 0
+	}
+}
+
+// RegisterGRPC registers Vertex AI services on the gRPC server.
+func (s *Server) RegisterGRPC(g *grpc.Server) {
+	registerVertex(g, s)
+}
+
+// Start serves gRPC and HTTP on random local ports.
+func (s *Server) Start() error {
+	return s.Listen("127.0.0.1:0", "127.0.0.1:0")
+}
+
+// Listen serves gRPC on grpcAddr and HTTP on httpAddr.
+func (s *Server) Listen(grpcAddr, httpAddr string) error {
+	var err error
+	if s.grpcLis, err = net.Listen("tcp", grpcAddr); err != nil {
+		return err
+	}
+	if s.httpLis, err = net.Listen("tcp", httpAddr); err != nil {
+		s.grpcLis.Close()
+		return err
+	}
+	s.grpcServer = grpc.NewServer()
+	s.RegisterGRPC(s.grpcServer)
+	s.httpServer = &http.Server{Handler: s.HTTPHandler()}
+	go s.grpcServer.Serve(s.grpcLis)
+	go func() {
+		if err := s.httpServer.Serve(s.httpLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("fake http server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the servers started by Start or Listen.
+func (s *Server) Close() {
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// GRPCAddr returns the address of gRPC server.
+func (s *Server) GRPCAddr() string {
+	return s.grpcLis.Addr().String()
+}
+
+// OpenAIBaseURL returns the base URL of OpenAI compatible API.
+func (s *Server) OpenAIBaseURL() string {
+	return "http://" + s.httpLis.Addr().String() + "/v1"
+}
+
+// ClientOptions returns options to connect Vertex AI clients to the server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return llm.EmulatorClientOptions(s.GRPCAddr())
+}
+
+// match records the request and returns a copy of the matching rule.
+func (s *Server) match(r Request) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.Time = time.Now()
+	var rule *Rule
+	for _, candidate := range s.rules {
+		if candidate.matches(r.Method, r.Prompt) {
+			rule = candidate
+			break
+		}
+	}
+	if rule != nil {
+		rule.hits++
+		r.Rule = rule.Name
+	}
+	s.requests = append(s.requests, r)
+	slog.Debug("fake model request", "method", r.Method, "endpoint", r.Endpoint, "rule", r.Rule, "prompt", r.Prompt)
+	if rule == nil {
+		if r.Method == MethodEmbed {
+			return Rule{}, nil
+		}
+		return Rule{}, status.Errorf(codes.NotFound, "no rule matches %s request with prompt %q", r.Method, r.Prompt)
+	}
+	return *rule, nil
+}
+
+// respond waits for the rule latency and returns the rule error if set.
+func respond(ctx context.Context, rule Rule) error {
+	if err := wait(ctx, time.Duration(rule.Latency)); err != nil {
+		return err
+	}
+	if rule.Error != nil {
+		msg := rule.Error.Message
+		if msg == "" {
+			msg = fmt.Sprintf("injected error of rule %q", rule.Name)
+		}
+		return status.Error(rule.Error.Code, msg)
+	}
+	return nil
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func chunks(rule Rule) []string {
+	if len(rule.Chunks) > 0 {
+		return rule.Chunks
+	}
+	words := strings.SplitAfter(rule.Response, " ")
+	if len(words) == 0 {
+		return []string{""}
+	}
+	return words
+}
+
+// tokens approximates the number of tokens as the number of words.
+func tokens(text string) int32 {
+	return int32(len(strings.Fields(text)))
+}
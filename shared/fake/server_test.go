@@ -0,0 +1,105 @@
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minherz/aichallenges/shared/llm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startServer(t *testing.T, rules ...Rule) *Server {
+	t.Helper()
+	s, err := NewServer(Script{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newModel(t *testing.T, s *Server, backend string) llm.Model {
+	t.Helper()
+	cfg := llm.Config{Backend: backend, ProjectID: "test-project", Region: "us-central1", EndpointID: "123", ModelName: "test-model"}
+	if backend == llm.BackendOpenAI {
+		cfg.BaseURL = s.OpenAIBaseURL()
+	} else {
+		cfg.ClientOptions = s.ClientOptions()
+	}
+	m, err := llm.New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestServerResponds(t *testing.T) {
+	s := startServer(t,
+		Rule{Name: "rome", Pattern: "Rome", Response: "Visit the Colosseum."},
+		Rule{Name: "default", Response: "I do not know."},
+	)
+	tests := []struct {
+		backend string
+		method  string
+	}{
+		{llm.BackendGemma, MethodPredict},
+		{llm.BackendOpenAI, MethodChat},
+	}
+	for _, tc := range tests {
+		t.Run(tc.backend, func(t *testing.T) {
+			s.Reset()
+			m := newModel(t, s, tc.backend)
+			req := llm.UserMessage("What to see in Rome?")
+			req.SystemInstruction = "Be brief."
+			resp, err := m.Generate(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text != "Visit the Colosseum." {
+				t.Errorf("response = %q, want %q", resp.Text, "Visit the Colosseum.")
+			}
+			requests := s.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("recorded %d requests, want 1", len(requests))
+			}
+			r := requests[0]
+			if r.Method != tc.method || r.Rule != "rome" || r.Prompt != "What to see in Rome?" || r.SystemInstruction != "Be brief." {
+				t.Errorf("recorded request = %+v", r)
+			}
+		})
+	}
+}
+
+func TestServerInjectsErrors(t *testing.T) {
+	s := startServer(t,
+		Rule{Name: "unavailable", Pattern: "fail", Error: &Error{Code: codes.Unavailable, Message: "try later"}, Times: 1},
+		Rule{Name: "slow", Pattern: "slow", Response: "late", Latency: Duration(time.Second)},
+		Rule{Name: "default", Response: "ok"},
+	)
+	m := newModel(t, s, llm.BackendGemma)
+
+	_, err := m.Generate(context.Background(), llm.UserMessage("fail"))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Generate() error = %v, want code %v", err, codes.Unavailable)
+	}
+	// the error rule is limited to one request
+	if resp, err := m.Generate(context.Background(), llm.UserMessage("fail")); err != nil || resp.Text != "ok" {
+		t.Errorf("Generate() = %v, %v after the error rule is exhausted", resp, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := m.Generate(ctx, llm.UserMessage("slow")); err == nil {
+		t.Error("Generate() of the slow rule did not time out")
+	}
+	if d := time.Since(start); d > 900*time.Millisecond {
+		t.Errorf("Generate() returned after %v, the latency is not interrupted", d)
+	}
+}
@@ -0,0 +1,230 @@
+package fake
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	betapb "cloud.google.com/go/aiplatform/apiv1beta1/aiplatformpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type predictionService struct {
+	aiplatformpb.UnimplementedPredictionServiceServer
+	s *Server
+}
+
+type generationService struct {
+	betapb.UnimplementedPredictionServiceServer
+	s *Server
+}
+
+func registerVertex(g *grpc.Server, s *Server) {
+	aiplatformpb.RegisterPredictionServiceServer(g, &predictionService{s: s})
+	betapb.RegisterPredictionServiceServer(g, &generationService{s: s})
+}
+
+// Predict responds to Gemma endpoints with the text and to embedding models with the vector.
+func (p *predictionService) Predict(ctx context.Context, req *aiplatformpb.PredictRequest) (*aiplatformpb.PredictResponse, error) {
+	if len(req.Instances) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no instances")
+	}
+	fields := req.Instances[0].GetStructValue().GetFields()
+	if content, ok := fields["content"]; ok {
+		return p.embed(ctx, req, content.GetStringValue())
+	}
+	inputs := fields["inputs"].GetStringValue()
+	rule, err := p.s.match(gemmaRequest(req.Endpoint, inputs))
+	if err != nil {
+		return nil, err
+	}
+	if err := respond(ctx, rule); err != nil {
+		return nil, err
+	}
+	return &aiplatformpb.PredictResponse{
+		Predictions:      []*structpb.Value{structpb.NewStringValue(rule.Response)},
+		ModelDisplayName: "fake-gemma",
+	}, nil
+}
+
+// gemmaRequest uses the last user turn of Gemma chat template as the prompt.
+func gemmaRequest(endpoint, inputs string) Request {
+	const (
+		startTurnUser  = "<start_of_turn>user\n"
+		startTurnModel = "<start_of_turn>model"
+		endTurn        = "<end_of_turn>"
+	)
+	r := Request{Method: MethodPredict, Endpoint: endpoint, Prompt: inputs}
+	first := strings.Index(inputs, startTurnUser)
+	if first < 0 {
+		return r
+	}
+	r.SystemInstruction = strings.TrimSpace(inputs[:first])
+	r.Turns = strings.Count(inputs, startTurnUser) + strings.Count(inputs, startTurnModel+"\n")
+	prompt := inputs[strings.LastIndex(inputs, startTurnUser)+len(startTurnUser):]
+	if pos := strings.Index(prompt, endTurn); pos >= 0 {
+		prompt = prompt[:pos]
+	}
+	r.Prompt = prompt
+	return r
+}
+
+func (p *predictionService) embed(ctx context.Context, req *aiplatformpb.PredictRequest, content string) (*aiplatformpb.PredictResponse, error) {
+	rule, err := p.s.match(Request{Method: MethodEmbed, Endpoint: req.Endpoint, Prompt: content, Turns: 1})
+	if err != nil {
+		return nil, err
+	}
+	if err := respond(ctx, rule); err != nil {
+		return nil, err
+	}
+	dims := p.s.dimensionality
+	if v, ok := req.Parameters.GetStructValue().GetFields()["outputDimensionality"]; ok && v.GetNumberValue() > 0 {
+		dims = int(v.GetNumberValue())
+	}
+	values := make([]*structpb.Value, dims)
+	for i, v := range Vector(content, dims) {
+		values[i] = structpb.NewNumberValue(float64(v))
+	}
+	embeddings := structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"values": structpb.NewListValue(&structpb.ListValue{Values: values}),
+		"statistics": structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"token_count": structpb.NewNumberValue(float64(tokens(content))),
+			"truncated":   structpb.NewBoolValue(false),
+		}}),
+	}})
+	return &aiplatformpb.PredictResponse{
+		Predictions: []*structpb.Value{structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"embeddings": embeddings,
+		}})},
+	}, nil
+}
+
+// Vector returns the deterministic unit vector for the text.
+func Vector(text string, dims int) []float32 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+	vector := make([]float32, dims)
+	var norm float64
+	for i := range vector {
+		v := rnd.NormFloat64()
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+func (g *generationService) GenerateContent(ctx context.Context, req *betapb.GenerateContentRequest) (*betapb.GenerateContentResponse, error) {
+	rule, err := g.s.match(generateRequest(MethodGenerate, req))
+	if err != nil {
+		return nil, err
+	}
+	if err := respond(ctx, rule); err != nil {
+		return nil, err
+	}
+	return generateResponse(req, rule, rule.Response, true), nil
+}
+
+func (g *generationService) StreamGenerateContent(req *betapb.GenerateContentRequest, stream betapb.PredictionService_StreamGenerateContentServer) error {
+	ctx := stream.Context()
+	rule, err := g.s.match(generateRequest(MethodStream, req))
+	if err != nil {
+		return err
+	}
+	if rule.Error != nil {
+		return respond(ctx, rule)
+	}
+	parts := chunks(rule)
+	if rule.BlockReason != "" {
+		parts = []string{""}
+	}
+	for i, chunk := range parts {
+		if err := wait(ctx, time.Duration(rule.Latency)); err != nil {
+			return err
+		}
+		if err := stream.Send(generateResponse(req, rule, chunk, i == len(parts)-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateRequest(method string, req *betapb.GenerateContentRequest) Request {
+	r := Request{Method: method, Endpoint: req.Model, Turns: len(req.Contents)}
+	if req.SystemInstruction != nil {
+		r.SystemInstruction = contentText(req.SystemInstruction)
+	}
+	for i := len(req.Contents) - 1; i >= 0; i-- {
+		if req.Contents[i].Role == "user" {
+			r.Prompt = contentText(req.Contents[i])
+			break
+		}
+	}
+	for _, c := range req.Contents {
+		for _, p := range c.Parts {
+			if d := p.GetInlineData(); d != nil {
+				r.Blobs = append(r.Blobs, d.MimeType)
+			}
+		}
+	}
+	return r
+}
+
+func contentText(c *betapb.Content) string {
+	var text []string
+	for _, p := range c.Parts {
+		if t := p.GetText(); t != "" {
+			text = append(text, t)
+		}
+	}
+	return strings.Join(text, "")
+}
+
+// generateResponse returns the response with the text. The last response of the stream
+// carries the finish reason and the usage metadata.
+func generateResponse(req *betapb.GenerateContentRequest, rule Rule, text string, last bool) *betapb.GenerateContentResponse {
+	if rule.BlockReason != "" {
+		feedback := &betapb.GenerateContentResponse_PromptFeedback{
+			BlockReason: betapb.GenerateContentResponse_PromptFeedback_OTHER,
+		}
+		if v, ok := betapb.GenerateContentResponse_PromptFeedback_BlockedReason_value[rule.BlockReason]; ok {
+			feedback.BlockReason = betapb.GenerateContentResponse_PromptFeedback_BlockedReason(v)
+		}
+		return &betapb.GenerateContentResponse{PromptFeedback: feedback}
+	}
+	candidate := &betapb.Candidate{
+		Content: &betapb.Content{
+			Role:  "model",
+			Parts: []*betapb.Part{{Data: &betapb.Part_Text{Text: text}}},
+		},
+	}
+	resp := &betapb.GenerateContentResponse{Candidates: []*betapb.Candidate{candidate}}
+	if !last {
+		return resp
+	}
+	candidate.FinishReason = betapb.Candidate_STOP
+	if v, ok := betapb.Candidate_FinishReason_value[rule.FinishReason]; ok {
+		candidate.FinishReason = betapb.Candidate_FinishReason(v)
+	}
+	var prompt int32
+	for _, c := range req.Contents {
+		prompt += tokens(contentText(c))
+	}
+	resp.UsageMetadata = &betapb.GenerateContentResponse_UsageMetadata{
+		PromptTokenCount:     prompt,
+		CandidatesTokenCount: tokens(rule.Response),
+		TotalTokenCount:      prompt + tokens(rule.Response),
+	}
+	return resp
+}
@@ -0,0 +1,75 @@
+package guardrails
+
+import (
+	"context"
+	"fmt"
+
+	dlp "cloud.google.com/go/dlp/apiv2"
+	"cloud.google.com/go/dlp/apiv2/dlppb"
+)
+
+// DLPRedactor uses Cloud DLP to de-identify sensitive data.
+type DLPRedactor struct {
+	c         *dlp.Client
+	parent    string
+	infoTypes []*dlppb.InfoType
+}
+
+// NewDLPRedactor inspects the same info types as the challenge10 guardrail.
+func NewDLPRedactor(ctx context.Context, projectID string) (*DLPRedactor, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("DLP redactor requires project ID")
+	}
+	c, err := dlp.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize DLP client: %w", err)
+	}
+	var infoTypes []*dlppb.InfoType
+	for _, name := range []string{InfoTypeCreditCard, InfoTypeEmail, InfoTypePersonName, InfoTypeSSN, InfoTypePhone, InfoTypeStreetAddress} {
+		infoTypes = append(infoTypes, &dlppb.InfoType{Name: name})
+	}
+	return &DLPRedactor{c: c, parent: fmt.Sprintf("projects/%s/locations/global", projectID), infoTypes: infoTypes}, nil
+}
+
+func (r *DLPRedactor) Close() error {
+	return r.c.Close()
+}
+
+func (r *DLPRedactor) Redact(ctx context.Context, text string) (*Redaction, error) {
+	req := &dlppb.DeidentifyContentRequest{
+		Parent: r.parent,
+		InspectConfig: &dlppb.InspectConfig{
+			InfoTypes: r.infoTypes,
+		},
+		DeidentifyConfig: &dlppb.DeidentifyConfig{
+			Transformation: &dlppb.DeidentifyConfig_InfoTypeTransformations{
+				InfoTypeTransformations: &dlppb.InfoTypeTransformations{
+					Transformations: []*dlppb.InfoTypeTransformations_InfoTypeTransformation{{
+						InfoTypes: r.infoTypes,
+						PrimitiveTransformation: &dlppb.PrimitiveTransformation{
+							Transformation: &dlppb.PrimitiveTransformation_ReplaceWithInfoTypeConfig{
+								ReplaceWithInfoTypeConfig: &dlppb.ReplaceWithInfoTypeConfig{},
+							},
+						},
+					}},
+				},
+			},
+		},
+		Item: &dlppb.ContentItem{
+			DataItem: &dlppb.ContentItem_Value{Value: text},
+		},
+	}
+	resp, err := r.c.DeidentifyContent(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("DLP failed to de-identify content: %w", err)
+	}
+	result := &Redaction{Text: resp.GetItem().GetValue(), Counts: map[string]int{}}
+	for _, s := range resp.GetOverview().GetTransformationSummaries() {
+		for _, r := range s.GetResults() {
+			if r.GetCode() == dlppb.TransformationSummary_SUCCESS {
+				result.Counts[s.GetInfoType().GetName()] += int(r.GetCount())
+			}
+		}
+	}
+	return result, nil
+}
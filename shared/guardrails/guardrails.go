@@ -0,0 +1,86 @@
+package guardrails
+
+import (
+	"context"
+	"io"
+
+	"github.com/minherz/aichallenges/shared/config"
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Options holds the dependencies of the guardrails that are not part of the configuration.
+type Options struct {
+	// ProjectID is required by the Cloud DLP redactor.
+	ProjectID string
+	// Model is the classifier of the prompt injections and of the topic.
+	Model llm.Model
+	// Embed is required in TopicGuardEmbedding mode.
+	Embed EmbedFunc
+	// TopicThreshold is the minimal similarity in TopicGuardEmbedding mode. Defaults to DefaultTopicThreshold.
+	TopicThreshold float64
+}
+
+// Set is the guardrails of the agent. The checks that are disabled by the configuration are nil.
+type Set struct {
+	Redactor   Redactor
+	Injections *InjectionDetector
+	Topic      *TopicGuard
+	Safety     []llm.SafetySetting
+}
+
+// New creates the guardrails that are selected by the configuration.
+func New(ctx context.Context, g config.Guardrails, opts Options) (*Set, error) {
+	redactor, err := NewRedactor(ctx, g.Redactor, opts.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	s := &Set{Redactor: redactor}
+	var classifier llm.Model
+	if g.InjectionClassifier {
+		classifier = opts.Model
+	}
+	if s.Injections, err = NewInjectionDetector(g.InjectionAction, classifier); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.Topic, err = NewTopicGuard(ctx, TopicConfig{
+		Mode:       g.TopicGuard,
+		Keywords:   g.TopicKeywords,
+		Embed:      opts.Embed,
+		Threshold:  opts.TopicThreshold,
+		Classifier: opts.Model,
+		Refusal:    g.TopicRefusal,
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.Safety, err = g.Safety(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Callbacks returns the model callbacks that redact the user message, check it for prompt injections
+// and refuse off-topic messages before the model call, and log the response after it.
+func (s *Set) Callbacks() llm.Callbacks {
+	callbacks := llm.Callbacks{After: []llm.AfterModelCallback{llm.LogResponse}}
+	if s.Redactor != nil {
+		callbacks.Before = append(callbacks.Before, RedactionCallback(s.Redactor))
+	}
+	if s.Injections != nil {
+		callbacks.Before = append(callbacks.Before, InjectionCallback(s.Injections))
+	}
+	if s.Topic != nil {
+		callbacks.Before = append(callbacks.Before, TopicCallback(s.Topic))
+	}
+	return callbacks
+}
+
+// Close releases the resources of the redactor.
+func (s *Set) Close() {
+	if c, ok := s.Redactor.(io.Closer); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minherz/aichallenges/shared/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		guardrails  config.Guardrails
+		wantBefore  int
+		wantErr     bool
+		wantSafety  int
+		wantNoTopic bool
+	}{
+		{
+			name:       "all",
+			guardrails: config.Guardrails{Redactor: RedactorLocal, InjectionAction: InjectionActionBlock, TopicGuard: TopicGuardKeywords, SafetySettings: "harassment=block_only_high"},
+			wantBefore: 3,
+			wantSafety: 1,
+		},
+		{
+			name:        "none",
+			guardrails:  config.Guardrails{Redactor: RedactorNone, InjectionAction: InjectionActionNone, TopicGuard: TopicGuardNone},
+			wantNoTopic: true,
+		},
+		{
+			name:       "embedding without embed function",
+			guardrails: config.Guardrails{TopicGuard: TopicGuardEmbedding},
+			wantErr:    true,
+		},
+		{
+			name:       "unsupported injection action",
+			guardrails: config.Guardrails{InjectionAction: "ignore"},
+			wantErr:    true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(context.Background(), tc.guardrails, Options{})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("New() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			callbacks := s.Callbacks()
+			if len(callbacks.Before) != tc.wantBefore || len(callbacks.After) != 1 {
+				t.Errorf("callbacks = %d before and %d after, want %d and 1", len(callbacks.Before), len(callbacks.After), tc.wantBefore)
+			}
+			if len(s.Safety) != tc.wantSafety {
+				t.Errorf("safety settings = %+v, want %d", s.Safety, tc.wantSafety)
+			}
+			if (s.Topic == nil) != tc.wantNoTopic {
+				t.Errorf("topic guard = %v", s.Topic)
+			}
+		})
+	}
+}
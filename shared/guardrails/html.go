@@ -0,0 +1,257 @@
+package guardrails
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/llm"
+	nethtml "golang.org/x/net/html"
+)
+
+// FormattedResponse is the model response prepared for the web UI.
+type FormattedResponse struct {
+	// HTML is safe to assign to innerHTML.
+	HTML string
+	// Text is the plain text version of the response.
+	Text string
+}
+
+var (
+	fencePattern   = regexp.MustCompile("(?m)^[ \t]*```[a-zA-Z0-9_-]*[ \t]*$\n?")
+	htmlTagPattern = regexp.MustCompile(`<(?:[a-zA-Z][a-zA-Z0-9]*)(?:\s[^>]*)?/?>`)
+	blankLines     = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)*`)
+	spaces         = regexp.MustCompile(`[ \t\r\f]+`)
+
+	// allowedElements maps the allowed elements to their allowed attributes
+	allowedElements = map[string][]string{
+		"a": {"href"}, "p": nil, "br": nil, "hr": nil, "span": nil, "div": nil,
+		"ul": nil, "ol": {"start"}, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+		"table": nil, "caption": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+		"th": {"colspan", "rowspan"}, "td": {"colspan", "rowspan"},
+		"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+		"strong": nil, "b": nil, "em": nil, "i": nil, "u": nil, "sup": nil, "sub": nil,
+		"code": nil, "pre": nil, "blockquote": nil,
+	}
+	// droppedElements are removed together with their content
+	droppedElements = map[string]bool{
+		"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true,
+		"template": true, "textarea": true, "select": true, "title": true, "head": true, "svg": true, "math": true,
+	}
+	voidElements = map[string]bool{"br": true, "hr": true}
+	// implicitlyClosed lists the elements that are closed by the start of the same element
+	implicitlyClosed = map[string]bool{"p": true, "li": true, "tr": true, "td": true, "th": true, "dt": true, "dd": true}
+	// blockElements are separated by new lines in the plain text
+	blockElements = map[string]bool{
+		"p": true, "div": true, "ul": true, "ol": true, "dl": true, "table": true, "tr": true, "pre": true,
+		"blockquote": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+		"caption": true, "dt": true, "dd": true,
+	}
+)
+
+// FormatResponse strips markdown code fences and returns sanitized HTML and plain text versions of the response.
+// Responses without HTML tags are escaped and split into paragraphs.
+func FormatResponse(response string) FormattedResponse {
+	response = strings.TrimSpace(StripCodeFences(response))
+	var h string
+	if htmlTagPattern.MatchString(response) {
+		h = SanitizeHTML(response)
+	} else {
+		h = textToHTML(response)
+	}
+	return FormattedResponse{HTML: h, Text: PlainText(h)}
+}
+
+// FormatModelResponse is like FormatResponse but explains blocked and truncated responses.
+// Blocked responses are replaced with the explanation and truncated ones are followed by it.
+func FormatModelResponse(resp *llm.Response) FormattedResponse {
+	note := FinishReasonMessage(resp.FinishReason)
+	if resp.FinishReason.Blocked() || (strings.TrimSpace(resp.Text) == "" && note != "") {
+		return FormatResponse(note)
+	}
+	f := FormatResponse(resp.Text)
+	if note != "" {
+		f.HTML += "<p><em>" + html.EscapeString(note) + "</em></p>"
+		f.Text += "\n\n" + note
+	}
+	return f
+}
+
+// FinishReasonMessage returns the user friendly explanation of the finish reason
+// or an empty string for normal stops.
+func FinishReasonMessage(r llm.FinishReason) string {
+	switch r {
+	case llm.FinishReasonSafety:
+		return "Sorry, I cannot answer this because the answer was blocked by safety filters. Please rephrase your request."
+	case llm.FinishReasonRecitation:
+		return "Sorry, I cannot answer this because the answer would repeat existing content too closely. Please ask in a different way."
+	case llm.FinishReasonPromptBlocked:
+		return "Sorry, your message was blocked by safety filters. Please rephrase it."
+	case llm.FinishReasonMaxTokens:
+		return "The answer was cut short because it reached the maximum length. Ask me to continue or to make it shorter."
+	default:
+		return ""
+	}
+}
+
+// StripCodeFences removes markdown code fence lines, e.g. "```html", leaving the fenced content.
+func StripCodeFences(text string) string {
+	return fencePattern.ReplaceAllString(text, "")
+}
+
+// SanitizeHTML keeps only allowed elements and attributes. Links are limited to
+// http, https and mailto schemes and open in a new tab. Unclosed elements are closed.
+func SanitizeHTML(s string) string {
+	var (
+		b     strings.Builder
+		open  []string
+		depth int // nesting level inside dropped elements
+	)
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+		t := z.Token()
+		switch tt {
+		case nethtml.TextToken:
+			if depth == 0 {
+				b.WriteString(html.EscapeString(t.Data))
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedElements[t.Data] {
+				if tt == nethtml.StartTagToken && !voidElements[t.Data] {
+					depth++
+				}
+				continue
+			}
+			attrs, ok := allowedElements[t.Data]
+			if !ok || depth > 0 {
+				continue
+			}
+			if implicitlyClosed[t.Data] && len(open) > 0 && open[len(open)-1] == t.Data {
+				b.WriteString("</" + t.Data + ">")
+				open = open[:len(open)-1]
+			}
+			b.WriteString("<" + t.Data)
+			for _, a := range t.Attr {
+				if !contains(attrs, a.Key) {
+					continue
+				}
+				if a.Key == "href" && !safeURL(a.Val) {
+					continue
+				}
+				b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+			if t.Data == "a" {
+				b.WriteString(` target="_blank" rel="noopener noreferrer"`)
+			}
+			b.WriteString(">")
+			if !voidElements[t.Data] {
+				open = append(open, t.Data)
+			}
+		case nethtml.EndTagToken:
+			if droppedElements[t.Data] {
+				if depth > 0 {
+					depth--
+				}
+				continue
+			}
+			if depth > 0 {
+				continue
+			}
+			// close the element and all elements that were left open inside it
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != t.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// PlainText returns the text of the HTML. Block elements and line breaks become new lines
+// and list items are prefixed with dashes.
+func PlainText(s string) string {
+	var b strings.Builder
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	inPre := false
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+		t := z.Token()
+		switch tt {
+		case nethtml.TextToken:
+			if inPre {
+				b.WriteString(t.Data)
+			} else {
+				b.WriteString(spaces.ReplaceAllString(strings.ReplaceAll(t.Data, "\n", " "), " "))
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			switch {
+			case t.Data == "br":
+				b.WriteString("\n")
+			case t.Data == "li":
+				b.WriteString("\n- ")
+			case t.Data == "td" || t.Data == "th":
+				b.WriteString("\t")
+			case blockElements[t.Data]:
+				b.WriteString("\n\n")
+			}
+			inPre = inPre || t.Data == "pre"
+		case nethtml.EndTagToken:
+			if blockElements[t.Data] {
+				b.WriteString("\n\n")
+			}
+			if t.Data == "pre" {
+				inPre = false
+			}
+		}
+	}
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// textToHTML escapes the text and converts blank line separated blocks into paragraphs.
+func textToHTML(text string) string {
+	var b strings.Builder
+	for _, p := range blankLines.Split(text, -1) {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(p), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
+
+func safeURL(u string) bool {
+	u = strings.ToLower(strings.TrimSpace(u))
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "mailto:")
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package guardrails
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "allowed elements",
+			input: `<h2>Rome</h2><p>Visit the <strong>Colosseum</strong>.</p><ul><li>Day 1</li></ul>`,
+			want:  `<h2>Rome</h2><p>Visit the <strong>Colosseum</strong>.</p><ul><li>Day 1</li></ul>`,
+		},
+		{
+			name:  "script",
+			input: `<p>Hi</p><script>alert(1)</script><p>there</p>`,
+			want:  `<p>Hi</p><p>there</p>`,
+		},
+		{
+			name:  "style",
+			input: `<style>p { color: red }</style><p>Hi</p>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "iframe",
+			input: `<p>Map</p><iframe src="https://evil.example.com"><p>fallback</p></iframe>`,
+			want:  `<p>Map</p>`,
+		},
+		{
+			name:  "nested dropped elements",
+			input: `<svg><script>alert(1)</script><p>inside</p></svg><p>after</p>`,
+			want:  `<p>after</p>`,
+		},
+		{
+			name:  "unknown elements keep their text",
+			input: `<form action="/steal"><p>Name</p><input name="x"></form>`,
+			want:  `<p>Name</p>`,
+		},
+		{
+			name:  "event handler attributes",
+			input: `<p onclick="alert(1)" class="x">Hi</p><img src=x onerror="alert(1)">`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "https link",
+			input: `<a href="https://example.com/rome" title="Rome">Rome</a>`,
+			want:  `<a href="https://example.com/rome" target="_blank" rel="noopener noreferrer">Rome</a>`,
+		},
+		{
+			name:  "mailto link",
+			input: `<a href="mailto:info@example.com">mail</a>`,
+			want:  `<a href="mailto:info@example.com" target="_blank" rel="noopener noreferrer">mail</a>`,
+		},
+		{
+			name:  "javascript link",
+			input: `<a href="javascript:alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer">click</a>`,
+		},
+		{
+			name:  "uppercase javascript link",
+			input: `<a href="  JavaScript:alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer">click</a>`,
+		},
+		{
+			name:  "entity encoded javascript link",
+			input: `<a href="&#106;avascript&#58;alert(1)">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer">click</a>`,
+		},
+		{
+			name:  "data link",
+			input: `<a href="data:text/html;base64,PHNjcmlwdD4=">click</a>`,
+			want:  `<a target="_blank" rel="noopener noreferrer">click</a>`,
+		},
+		{
+			name:  "escaped attribute value",
+			input: `<a href="https://example.com/?q=&quot;&gt;&lt;script&gt;">q</a>`,
+			want:  `<a href="https://example.com/?q=&#34;&gt;&lt;script&gt;" target="_blank" rel="noopener noreferrer">q</a>`,
+		},
+		{
+			name:  "allowed attributes",
+			input: `<ol start="3" style="x"><li>three</li></ol><table><tr><td colspan="2" width="9">x</td></tr></table>`,
+			want:  `<ol start="3"><li>three</li></ol><table><tr><td colspan="2">x</td></tr></table>`,
+		},
+		{
+			name:  "unclosed elements",
+			input: `<p>Visit <strong>Rome`,
+			want:  `<p>Visit <strong>Rome</strong></p>`,
+		},
+		{
+			name:  "implicitly closed elements",
+			input: `<ul><li>one<li>two</ul>`,
+			want:  `<ul><li>one</li><li>two</li></ul>`,
+		},
+		{
+			name:  "misnested elements",
+			input: `<p><em>one</p>two</em>`,
+			want:  `<p><em>one</em></p>two`,
+		},
+		{
+			name:  "stray end tag",
+			input: `</div><p>Hi</p></span>`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "unclosed script drops the rest",
+			input: `<p>Hi</p><script>alert(1)`,
+			want:  `<p>Hi</p>`,
+		},
+		{
+			name:  "text is escaped",
+			input: `<p>5 &lt; 6 &amp; "quotes"</p>`,
+			want:  `<p>5 &lt; 6 &amp; &#34;quotes&#34;</p>`,
+		},
+		{
+			name:  "comments are removed",
+			input: `<p>Hi<!-- <script>alert(1)</script> --></p>`,
+			want:  `<p>Hi</p>`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SanitizeHTML(tc.input); got != tc.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "html in code fence",
+			response: "```html\n<p>Visit <b>Rome</b></p>\n```",
+			wantHTML: "<p>Visit <b>Rome</b></p>",
+			wantText: "Visit Rome",
+		},
+		{
+			name:     "indented code fence",
+			response: "  ```\n<p>Rome</p>\n  ```  ",
+			wantHTML: "<p>Rome</p>",
+			wantText: "Rome",
+		},
+		{
+			name:     "plain text",
+			response: "Day 1: Rome\nDay 2: Florence\n\nBudget < 500 & \"cheap\" food",
+			wantHTML: "<p>Day 1: Rome<br>Day 2: Florence</p><p>Budget &lt; 500 &amp; &#34;cheap&#34; food</p>",
+			wantText: "Day 1: Rome\nDay 2: Florence\n\nBudget < 500 & \"cheap\" food",
+		},
+		{
+			name:     "script in fenced html",
+			response: "```html\n<p>Hi</p><script>alert(1)</script>\n```",
+			wantHTML: "<p>Hi</p>",
+			wantText: "Hi",
+		},
+		{
+			name:     "empty",
+			response: "",
+			wantHTML: "",
+			wantText: "",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FormatResponse(tc.response)
+			if got.HTML != tc.wantHTML {
+				t.Errorf("HTML = %q, want %q", got.HTML, tc.wantHTML)
+			}
+			if got.Text != tc.wantText {
+				t.Errorf("Text = %q, want %q", got.Text, tc.wantText)
+			}
+		})
+	}
+}
+
+func TestFormatModelResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llm.Response
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "stop",
+			response: llm.Response{Text: "<p>Rome</p>", FinishReason: llm.FinishReasonStop},
+			wantHTML: "<p>Rome</p>",
+			wantText: "Rome",
+		},
+		{
+			name:     "blocked",
+			response: llm.Response{Text: "<p>partial</p>", FinishReason: llm.FinishReasonSafety},
+			wantHTML: "<p>" + FinishReasonMessage(llm.FinishReasonSafety) + "</p>",
+			wantText: FinishReasonMessage(llm.FinishReasonSafety),
+		},
+		{
+			name:     "truncated",
+			response: llm.Response{Text: "<p>Day 1</p>", FinishReason: llm.FinishReasonMaxTokens},
+			wantHTML: "<p>Day 1</p><p><em>" + FinishReasonMessage(llm.FinishReasonMaxTokens) + "</em></p>",
+			wantText: "Day 1\n\n" + FinishReasonMessage(llm.FinishReasonMaxTokens),
+		},
+		{
+			name:     "empty truncated",
+			response: llm.Response{FinishReason: llm.FinishReasonMaxTokens},
+			wantHTML: "<p>" + FinishReasonMessage(llm.FinishReasonMaxTokens) + "</p>",
+			wantText: FinishReasonMessage(llm.FinishReasonMaxTokens),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FormatModelResponse(&tc.response)
+			if got.HTML != tc.wantHTML {
+				t.Errorf("HTML = %q, want %q", got.HTML, tc.wantHTML)
+			}
+			if got.Text != tc.wantText {
+				t.Errorf("Text = %q, want %q", got.Text, tc.wantText)
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"line breaks", "<p>One<br>Two</p>", "One\nTwo"},
+		{"list", "<h3>Plan</h3><ul><li>Rome</li><li>Florence</li></ul>", "Plan\n\n- Rome\n- Florence"},
+		{"table", "<table><tr><th>Day</th><th>City</th></tr><tr><td>1</td><td>Rome</td></tr></table>", "Day\tCity\n\n1\tRome"},
+		{"collapsed spaces", "<p>Visit   the\n  Colosseum</p>", "Visit the Colosseum"},
+		{"preformatted", "<pre>a  b\n  c</pre>", "a  b\nc"},
+		{"entities", "<p>5 &lt; 6 &amp; 7</p>", "5 < 6 & 7"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PlainText(tc.input); got != tc.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeHTMLNoActiveContent(t *testing.T) {
+	inputs := []string{
+		`<scr<script>ipt>alert(1)</script>`,
+		`<a href="java&#x09;script:alert(1)">x</a>`,
+		`<p/onmouseover=alert(1)>x</p>`,
+		`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+		`<<script>script>alert(1)<</script>/script>`,
+	}
+	for _, input := range inputs {
+		got := strings.ToLower(SanitizeHTML(input))
+		for _, bad := range []string{"<script", "javascript:", "onerror", "onmouseover", "<img", "<style"} {
+			if strings.Contains(got, bad) {
+				t.Errorf("SanitizeHTML(%q) = %q contains %q", input, got, bad)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package guardrails implements checks and transformations of the text that is sent
+// to the model and of the model responses.
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+// Info types use the names of Cloud DLP built-in info types.
+const (
+	InfoTypeCreditCard    = "CREDIT_CARD_NUMBER"
+	InfoTypeEmail         = "EMAIL_ADDRESS"
+	InfoTypePersonName    = "PERSON_NAME"
+	InfoTypeSSN           = "US_SOCIAL_SECURITY_NUMBER"
+	InfoTypePhone         = "PHONE_NUMBER"
+	InfoTypeStreetAddress = "STREET_ADDRESS"
+)
+
+const (
+	RedactorLocal = "local"
+	RedactorDLP   = "dlp"
+	RedactorNone  = "none"
+)
+
+// Redaction is the redacted text and the number of redacted findings per info type.
+type Redaction struct {
+	Text   string
+	Counts map[string]int
+}
+
+// Total returns the number of redacted findings.
+func (r *Redaction) Total() int {
+	var total int
+	for _, c := range r.Counts {
+		total += c
+	}
+	return total
+}
+
+// Redactor replaces sensitive data in the text with the name of its info type, e.g. "[EMAIL_ADDRESS]".
+type Redactor interface {
+	Redact(ctx context.Context, text string) (*Redaction, error)
+}
+
+// NewRedactor returns the redactor of the kind. DLP redactor requires projectID.
+// It returns nil redactor for RedactorNone.
+func NewRedactor(ctx context.Context, kind, projectID string) (Redactor, error) {
+	switch strings.ToLower(kind) {
+	case RedactorLocal:
+		return NewLocalRedactor(), nil
+	case RedactorDLP:
+		return NewDLPRedactor(ctx, projectID)
+	case RedactorNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported redactor %q", kind)
+	}
+}
+
+type detector struct {
+	infoType string
+	re       *regexp.Regexp
+	// valid filters out false positives that cannot be expressed as regular expression
+	valid func(match string) bool
+}
+
+// LocalRedactor detects sensitive data using regular expressions. It works offline.
+// It does not detect person names.
+type LocalRedactor struct {
+	detectors []detector
+}
+
+// NewLocalRedactor returns the redactor that detects credit card numbers (Luhn checked),
+// emails, US social security numbers, phone numbers and US street addresses.
+func NewLocalRedactor() *LocalRedactor {
+	// detectors run in order, so longer digit sequences are redacted before shorter ones
+	return &LocalRedactor{detectors: []detector{
+		{
+			infoType: InfoTypeCreditCard,
+			re:       regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			valid:    luhnValid,
+		},
+		{
+			infoType: InfoTypeEmail,
+			re:       regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		},
+		{
+			infoType: InfoTypeSSN,
+			re:       regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b`),
+			valid:    ssnValid,
+		},
+		{
+			// numbers without separators, e.g. booking confirmations, are phone numbers only with the country code
+			infoType: InfoTypePhone,
+			re: regexp.MustCompile(`\+\d{1,3}[\s.-]?(?:\(\d{3}\)|\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b` +
+				`|\(\d{3}\)\s?\d{3}[\s.-]?\d{4}\b` +
+				`|\b\d{3}[\s.-]\d{3}[\s.-]\d{4}\b`),
+		},
+		{
+			infoType: InfoTypeStreetAddress,
+			// the street name must be capitalized, so travel phrases like "2 blocks down the road" are kept
+			re: regexp.MustCompile(`\b\d{1,6}\s+(?:[A-Z0-9][A-Za-z0-9.'-]*\s+){1,4}` +
+				`(?i:street|st|avenue|ave|road|rd|boulevard|blvd|lane|ln|drive|dr|court|ct|way|place|pl|terrace|parkway|pkwy|highway|hwy)\b\.?`),
+		},
+	}}
+}
+
+func (r *LocalRedactor) Redact(_ context.Context, text string) (*Redaction, error) {
+	result := &Redaction{Text: text, Counts: map[string]int{}}
+	for _, d := range r.detectors {
+		replacement := "[" + d.infoType + "]"
+		result.Text = d.re.ReplaceAllStringFunc(result.Text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			result.Counts[d.infoType]++
+			return replacement
+		})
+	}
+	return result, nil
+}
+
+// luhnValid validates the check digit of the card number.
+func luhnValid(number string) bool {
+	var sum, n int
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// ssnValid excludes numbers that are never issued.
+func ssnValid(ssn string) bool {
+	digits := strings.NewReplacer("-", "", " ", "").Replace(ssn)
+	area, group, serial := digits[:3], digits[3:5], digits[5:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// RedactText redacts the text and logs the number of findings per info type but not the findings.
+// It returns the text unchanged if r is nil. The attrs are added to the log entry.
+func RedactText(ctx context.Context, r Redactor, text string, attrs ...any) (string, error) {
+	if r == nil {
+		return text, nil
+	}
+	result, err := r.Redact(ctx, text)
+	if err != nil {
+		return "", fmt.Errorf("cannot redact sensitive data: %w", err)
+	}
+	if total := result.Total(); total > 0 {
+		attrs = append(attrs, "redacted_total", total)
+		for infoType, count := range result.Counts {
+			attrs = append(attrs, "redacted_"+strings.ToLower(infoType), count)
+		}
+		slog.Info("sensitive data is redacted", attrs...)
+	}
+	return result.Text, nil
+}
+
+// RedactionCallback returns the before model callback that redacts the last user message.
+// Earlier messages are expected to be redacted when they were sent.
+func RedactionCallback(r Redactor) llm.BeforeModelCallback {
+	return func(ctx context.Context, req *llm.Request) (*llm.Response, error) {
+		msg := req.LastUserMessage()
+		if msg == nil {
+			return nil, nil
+		}
+		text, err := RedactText(ctx, r, msg.Text, append([]any{"session", llm.SessionFromContext(ctx)}, llm.LogAttrsFromContext(ctx)...)...)
+		if err != nil {
+			return nil, err
+		}
+		msg.Text = text
+		return nil, nil
+	}
+}
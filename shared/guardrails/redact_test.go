@@ -0,0 +1,36 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLocalRedactor(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Call me at 555-123-4567", "Call me at [PHONE_NUMBER]"},
+		{"Call me at (555) 123-4567", "Call me at [PHONE_NUMBER]"},
+		{"Call me at +1 555 123 4567", "Call me at [PHONE_NUMBER]"},
+		{"Call me at +15551234567", "Call me at [PHONE_NUMBER]"},
+		{"My booking number is 5551234567", "My booking number is 5551234567"},
+		{"I live at 221 Baker Street", "I live at [STREET_ADDRESS]"},
+		{"Pick me up at 1600 Pennsylvania Ave.", "Pick me up at [STREET_ADDRESS]"},
+		{"Meet at 10 Downing st", "Meet at [STREET_ADDRESS]"},
+		{"Plan 3 days in the way you like", "Plan 3 days in the way you like"},
+		{"Book 5 nights at the place near the beach", "Book 5 nights at the place near the beach"},
+		{"The museum is 2 blocks down the road", "The museum is 2 blocks down the road"},
+		{"Email jane.doe@example.com", "Email [EMAIL_ADDRESS]"},
+	}
+	r := NewLocalRedactor()
+	for _, tc := range tests {
+		got, err := r.Redact(context.Background(), tc.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Text != tc.want {
+			t.Errorf("Redact(%q) = %q, want %q", tc.text, got.Text, tc.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package guardrails
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minherz/aichallenges/shared/llm"
+)
+
+func TestTopicCallback(t *testing.T) {
+	g, err := NewTopicGuard(context.Background(), TopicConfig{Mode: TopicGuardKeywords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := TopicCallback(g)
+	tests := []struct {
+		name     string
+		messages []string
+		refused  bool
+	}{
+		{"on topic", []string{"Plan 3 days in Rome"}, false},
+		{"off topic", []string{"write me a Python web scraper"}, true},
+		{"off topic after on topic", []string{"Plan 3 days in Rome", "write me a Python web scraper"}, true},
+		{"short message", []string{"Plan 3 days in Rome", "thanks a lot"}, false},
+		{"follow-up", []string{"Plan 3 days in Rome", "could you make it a bit more relaxed"}, false},
+		{"long request with reference", []string{"Plan 3 days in Rome", "forget that and write me a Python web scraper that collects prices from every online shop"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &llm.Request{}
+			for _, m := range tc.messages {
+				req.Messages = append(req.Messages, llm.Message{Role: llm.RoleUser, Text: m}, llm.Message{Role: llm.RoleModel, Text: "ok"})
+			}
+			req.Messages = req.Messages[:len(req.Messages)-1]
+			resp, err := callback(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refused := resp != nil; refused != tc.refused {
+				t.Errorf("refused = %v, want %v", refused, tc.refused)
+			}
+			if resp != nil && resp.FinishReason != llm.FinishReasonRefused {
+				t.Errorf("finish reason = %q, want %q", resp.FinishReason, llm.FinishReasonRefused)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// BeforeModelCallback is called before the request is sent to the model.
+// It can modify the request in place; Chat stores the modified messages in its history.
+// Returning a non-nil response skips the model and the remaining before callbacks.
+// Returning an error fails the call.
+type BeforeModelCallback func(ctx context.Context, req *Request) (*Response, error)
+
+// AfterModelCallback is called with the model response.
+// It can modify the response or return another one. Returning an error blocks the response.
+type AfterModelCallback func(ctx context.Context, req *Request, resp *Response) (*Response, error)
+
+// Callbacks are called around each model call in the order they are listed.
+type Callbacks struct {
+	Before []BeforeModelCallback
+	After  []AfterModelCallback
+}
+
+type callbackModel struct {
+	Model
+	cb Callbacks
+}
+
+// WithCallbacks returns the model that runs the callbacks around the calls to m.
+// When after callbacks are set, Stream buffers the response and passes the result
+// of the callbacks to fn as one chunk because streamed text cannot be rewritten or blocked.
+func WithCallbacks(m Model, cb Callbacks) Model {
+	if len(cb.Before) == 0 && len(cb.After) == 0 {
+		return m
+	}
+	return &callbackModel{Model: m, cb: cb}
+}
+
+func (m *callbackModel) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if resp, err := m.before(ctx, req); resp != nil || err != nil {
+		return resp, err
+	}
+	resp, err := m.Model.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return m.after(ctx, req, resp)
+}
+
+func (m *callbackModel) Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	resp, err := m.before(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		if err := fn(resp.Text); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	if len(m.cb.After) == 0 {
+		return m.Model.Stream(ctx, req, fn)
+	}
+	if resp, err = m.Model.Generate(ctx, req); err != nil {
+		return nil, err
+	}
+	if resp, err = m.after(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	if err := fn(resp.Text); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *callbackModel) before(ctx context.Context, req *Request) (*Response, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	for _, cb := range m.cb.Before {
+		resp, err := cb(ctx, req)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
+
+func (m *callbackModel) after(ctx context.Context, req *Request, resp *Response) (*Response, error) {
+	var err error
+	for _, cb := range m.cb.After {
+		if resp, err = cb(ctx, req, resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+type sessionKey struct{}
+
+// ContextWithSession returns the context that carries the chat session ID to the callbacks.
+func ContextWithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionFromContext returns the chat session ID or an empty string.
+func SessionFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+type logAttrsKey struct{}
+
+// ContextWithLogAttrs returns the context that carries additional attributes
+// for the callback logs, e.g. the version of the system instructions.
+func ContextWithLogAttrs(ctx context.Context, attrs ...any) context.Context {
+	return context.WithValue(ctx, logAttrsKey{}, append(LogAttrsFromContext(ctx), attrs...))
+}
+
+// LogAttrsFromContext returns a copy of the attributes set by ContextWithLogAttrs.
+func LogAttrsFromContext(ctx context.Context) []any {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]any)
+	return slices.Clone(attrs)
+}
+
+// LogResponse is the after callback that logs the model and the token usage.
+func LogResponse(ctx context.Context, req *Request, resp *Response) (*Response, error) {
+	slog.Debug("model responded", append([]any{
+		"session", SessionFromContext(ctx),
+		"model", resp.Model,
+		"turns", len(req.Messages),
+		"prompt_tokens", resp.Usage.PromptTokens,
+		"response_tokens", resp.Usage.ResponseTokens,
+		"total_tokens", resp.Usage.TotalTokens,
+		"finish_reason", resp.FinishReason}, LogAttrsFromContext(ctx)...)...)
+	if resp.FinishReason.Blocked() {
+		attrs := append([]any{"session", SessionFromContext(ctx), "model", resp.Model, "finish_reason", resp.FinishReason}, LogAttrsFromContext(ctx)...)
+		for _, r := range resp.SafetyRatings {
+			attrs = append(attrs, "safety_"+strings.ToLower(r.Category), r.Probability)
+		}
+		slog.Warn("model response is blocked", attrs...)
+	}
+	return resp, nil
+}
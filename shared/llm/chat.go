@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Chat manages the conversation state of a multi-turn chat on top of a Model.
+// Turns of the same chat are serialized.
+type Chat struct {
+	m       Model
+	mu      sync.Mutex
+	history []Message
+}
+
+func NewChat(m Model) *Chat {
+	return &Chat{m: m}
+}
+
+// History returns a copy of the conversation so far.
+func (c *Chat) History() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.history)
+}
+
+// Send prepends the conversation history to the request messages and sends it to the model.
+// The history is updated only when the model responds successfully. Blocked and refused exchanges
+// are not kept, so the user can rephrase the message.
+func (c *Chat) Send(ctx context.Context, req *Request) (*Response, error) {
+	return c.send(req, func(r *Request) (*Response, error) {
+		return c.m.Generate(ctx, r)
+	})
+}
+
+// SendStream is like Send but streams the response to fn.
+func (c *Chat) SendStream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	return c.send(req, func(r *Request) (*Response, error) {
+		return c.m.Stream(ctx, r, fn)
+	})
+}
+
+func (c *Chat) send(req *Request, call func(*Request) (*Response, error)) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := *req
+	r.Messages = append(slices.Clone(c.history), req.Messages...)
+	resp, err := call(&r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.FinishReason.Blocked() || resp.FinishReason == FinishReasonRefused {
+		return resp, nil
+	}
+	c.history = append(r.Messages, Message{Role: RoleModel, Text: resp.Text})
+	return resp, nil
+}
@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// stubModel returns the responses in order and records the messages of the requests.
+type stubModel struct {
+	responses []*Response
+	errs      []error
+	requests  [][]Message
+}
+
+func (m *stubModel) Name() string { return "stub" }
+
+func (m *stubModel) Generate(_ context.Context, req *Request) (*Response, error) {
+	m.requests = append(m.requests, slices.Clone(req.Messages))
+	i := len(m.requests) - 1
+	if i < len(m.errs) && m.errs[i] != nil {
+		return nil, m.errs[i]
+	}
+	return m.responses[i], nil
+}
+
+func (m *stubModel) Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	resp, err := m.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, fn(resp.Text)
+}
+
+func (m *stubModel) Close() error { return nil }
+
+func texts(messages []Message) []string {
+	var list []string
+	for _, m := range messages {
+		list = append(list, string(m.Role)+": "+m.Text)
+	}
+	return list
+}
+
+func TestChatHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *Response
+		err      error
+		kept     bool
+	}{
+		{name: "stop", response: &Response{Text: "Visit Rome.", FinishReason: FinishReasonStop}, kept: true},
+		{name: "truncated", response: &Response{Text: "Visit", FinishReason: FinishReasonMaxTokens}, kept: true},
+		{name: "safety", response: &Response{FinishReason: FinishReasonSafety}},
+		{name: "recitation", response: &Response{FinishReason: FinishReasonRecitation}},
+		{name: "prompt blocked", response: &Response{FinishReason: FinishReasonPromptBlocked}},
+		{name: "refused", response: &Response{Text: "Sorry, I can only help with travel planning.", FinishReason: FinishReasonRefused}},
+		{name: "error", err: errors.New("unavailable")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, stream := range []bool{false, true} {
+				m := &stubModel{
+					responses: []*Response{{Text: "Hello!", FinishReason: FinishReasonStop}, tc.response, {Text: "Sure.", FinishReason: FinishReasonStop}},
+					errs:      []error{nil, tc.err},
+				}
+				c := NewChat(m)
+				send := func(text string) (*Response, error) {
+					if stream {
+						return c.SendStream(context.Background(), UserMessage(text), func(string) error { return nil })
+					}
+					return c.Send(context.Background(), UserMessage(text))
+				}
+				if _, err := send("Hi"); err != nil {
+					t.Fatal(err)
+				}
+				resp, err := send("Plan a trip")
+				if tc.err != nil {
+					if err == nil {
+						t.Errorf("Send() succeeded, want %v", tc.err)
+					}
+				} else if err != nil || resp != tc.response {
+					t.Errorf("Send() = %+v, %v, want %+v", resp, err, tc.response)
+				}
+
+				want := []string{"user: Hi", "model: Hello!"}
+				if tc.kept {
+					want = append(want, "user: Plan a trip", "model: "+tc.response.Text)
+				}
+				if got := texts(c.History()); !slices.Equal(got, want) {
+					t.Errorf("stream %v: History() = %q, want %q", stream, got, want)
+				}
+				// the next request is sent with the kept history only
+				if _, err := send("Thanks"); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := texts(m.requests[2]), append(want, "user: Thanks"); !slices.Equal(got, want) {
+					t.Errorf("stream %v: next request = %q, want %q", stream, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// EmulatorHostEnvVar is the address of the server that replaces Vertex AI, e.g. the fake model server.
+// Vertex AI clients connect to it without authentication when it is set.
+const EmulatorHostEnvVar = "VERTEX_AI_EMULATOR_HOST"
+
+const (
+	BackendGemma  = "gemma"
+	BackendGemini = "gemini"
+	BackendOpenAI = "openai"
+)
+
+// Config selects the model backend and holds the settings of all backends.
+type Config struct {
+	Backend   string
+	ProjectID string
+	Region    string
+	// ModelName is the name of Gemini model or the model served by OpenAI compatible server.
+	ModelName string
+	// EndpointID is the ID of Vertex AI endpoint of the deployed Gemma model.
+	EndpointID string
+	// Parameters are additional prediction parameters of the deployed model.
+	Parameters    map[string]interface{}
+	ClientOptions []option.ClientOption
+	// BaseURL is the base URL of OpenAI compatible API, e.g. "http://localhost:11434/v1".
+	BaseURL string
+	// APIKey is sent as the bearer token to OpenAI compatible API.
+	APIKey string
+	// HTTPClient is used to call OpenAI compatible API; http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+}
+
+// New returns the model for the configured backend.
+func New(ctx context.Context, cfg Config) (Model, error) {
+	cfg.ClientOptions = append(cfg.ClientOptions, EmulatorOptions()...)
+	switch strings.ToLower(cfg.Backend) {
+	case BackendGemma:
+		return NewGemma(ctx, cfg)
+	case BackendGemini:
+		return NewGemini(ctx, cfg)
+	case BackendOpenAI:
+		return NewOpenAI(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported model backend %q", cfg.Backend)
+	}
+}
+
+// EmulatorOptions returns client options to connect to the emulator if EmulatorHostEnvVar is set.
+func EmulatorOptions() []option.ClientOption {
+	if host := os.Getenv(EmulatorHostEnvVar); host != "" {
+		return EmulatorClientOptions(host)
+	}
+	return nil
+}
+
+// EmulatorClientOptions returns client options to connect to the insecure server listening on addr.
+func EmulatorClientOptions(addr string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
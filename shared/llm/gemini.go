@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+	"google.golang.org/api/iterator"
+)
+
+// Gemini calls Gemini models using Vertex AI SDK.
+type Gemini struct {
+	c         *genai.Client
+	modelName string
+}
+
+// NewGemini creates Vertex AI client for cfg.ModelName in cfg.Region.
+func NewGemini(ctx context.Context, cfg Config) (*Gemini, error) {
+	if cfg.ProjectID == "" || cfg.Region == "" || cfg.ModelName == "" {
+		return nil, fmt.Errorf("gemini requires project, region and model name")
+	}
+	c, err := genai.NewClient(ctx, cfg.ProjectID, cfg.Region, cfg.ClientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize Vertex AI client: %w", err)
+	}
+	return &Gemini{c: c, modelName: cfg.ModelName}, nil
+}
+
+func (g *Gemini) Name() string {
+	return g.modelName
+}
+
+func (g *Gemini) Close() error {
+	return g.c.Close()
+}
+
+func (g *Gemini) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	cs, parts := g.startChat(req)
+	resp, err := cs.SendMessage(ctx, parts...)
+	if err != nil {
+		return g.blocked(err)
+	}
+	return g.response(resp)
+}
+
+func (g *Gemini) Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	cs, parts := g.startChat(req)
+	it := cs.SendMessageStream(ctx, parts...)
+	var usage *genai.UsageMetadata
+	for {
+		chunk, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return g.blocked(err)
+		}
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		if text := responseText(chunk); text != "" {
+			if err := fn(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	merged := it.MergedResponse()
+	if merged != nil && merged.UsageMetadata == nil {
+		// the merged response does not aggregate usage that is reported in the last chunk
+		merged.UsageMetadata = usage
+	}
+	return g.response(merged)
+}
+
+// startChat configures the model for the request and returns the chat session
+// with the request history and the parts of the last message.
+func (g *Gemini) startChat(req *Request) (*genai.ChatSession, []genai.Part) {
+	m := g.c.GenerativeModel(g.modelName)
+	if req.SystemInstruction != "" {
+		m.SystemInstruction = &genai.Content{
+			Parts: []genai.Part{genai.Text(req.SystemInstruction)},
+		}
+	}
+	m.GenerationConfig = genai.GenerationConfig{
+		Temperature:      req.Config.Temperature,
+		TopP:             req.Config.TopP,
+		TopK:             req.Config.TopK,
+		MaxOutputTokens:  req.Config.MaxOutputTokens,
+		ResponseMIMEType: req.Config.ResponseMIMEType,
+		ResponseSchema:   geminiSchema(req.Config.ResponseSchema),
+	}
+	m.SafetySettings = geminiSafetySettings(req.SafetySettings)
+	cs := m.StartChat()
+	last := len(req.Messages) - 1
+	for _, msg := range req.Messages[:last] {
+		cs.History = append(cs.History, &genai.Content{
+			Role:  string(msg.Role),
+			Parts: geminiParts(msg),
+		})
+	}
+	return cs, geminiParts(req.Messages[last])
+}
+
+// geminiParts returns the text of the message followed by its attachments.
+func geminiParts(msg Message) []genai.Part {
+	parts := make([]genai.Part, 0, len(msg.Blobs)+1)
+	if msg.Text != "" || len(msg.Blobs) == 0 {
+		parts = append(parts, genai.Text(msg.Text))
+	}
+	for _, b := range msg.Blobs {
+		parts = append(parts, genai.Blob{MIMEType: b.MIMEType, Data: b.Data})
+	}
+	return parts
+}
+
+func (g *Gemini) response(resp *genai.GenerateContentResponse) (*Response, error) {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0] == nil {
+		return nil, fmt.Errorf("model has no answer")
+	}
+	r := &Response{
+		Text:          responseText(resp),
+		Model:         g.modelName,
+		FinishReason:  geminiFinishReason(resp.Candidates[0].FinishReason),
+		SafetyRatings: geminiSafetyRatings(resp.Candidates[0].SafetyRatings),
+	}
+	if u := resp.UsageMetadata; u != nil {
+		r.Usage = Usage{
+			PromptTokens:   u.PromptTokenCount,
+			ResponseTokens: u.CandidatesTokenCount,
+			TotalTokens:    u.TotalTokenCount,
+		}
+	}
+	return r, nil
+}
+
+// blocked converts the error of the blocked prompt or response to the response without text.
+// Other errors are returned as is.
+func (g *Gemini) blocked(err error) (*Response, error) {
+	var blocked *genai.BlockedError
+	if !errors.As(err, &blocked) {
+		return nil, err
+	}
+	r := &Response{Model: g.modelName}
+	if c := blocked.Candidate; c != nil {
+		r.FinishReason = geminiFinishReason(c.FinishReason)
+		r.SafetyRatings = geminiSafetyRatings(c.SafetyRatings)
+	} else {
+		r.FinishReason = FinishReasonPromptBlocked
+		if f := blocked.PromptFeedback; f != nil {
+			r.SafetyRatings = geminiSafetyRatings(f.SafetyRatings)
+		}
+	}
+	return r, nil
+}
+
+// responseText concatenates text parts of the first candidate.
+func responseText(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 || resp.Candidates[0] == nil || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var text []string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if t, ok := part.(genai.Text); ok && len(t) > 0 {
+			text = append(text, string(t))
+		}
+	}
+	return strings.Join(text, "")
+}
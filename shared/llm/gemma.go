@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	startTurnUser         = "<start_of_turn>user"
+	startTurnModel        = "<start_of_turn>model"
+	endTurn               = "<end_of_turn>"
+	chatTurnTemplate      = "%s\n%s%s"
+	modelEndpointTemplate = "projects/%s/locations/%s/endpoints/%s"
+)
+
+// Gemma calls Gemma model deployed to Vertex AI endpoint.
+// The conversation is formatted using Gemma chat template.
+type Gemma struct {
+	c           *aiplatform.PredictionClient
+	endpointUri string
+	parameters  map[string]interface{}
+}
+
+// NewGemma connects to the endpoint cfg.EndpointID in cfg.Region.
+// cfg.Parameters are sent with every request in addition to the generation config.
+func NewGemma(ctx context.Context, cfg Config) (*Gemma, error) {
+	if cfg.ProjectID == "" || cfg.Region == "" || cfg.EndpointID == "" {
+		return nil, fmt.Errorf("gemma requires project, region and endpoint ID")
+	}
+	opts := append([]option.ClientOption{option.WithEndpoint(fmt.Sprintf("%s-aiplatform.googleapis.com:443", cfg.Region))}, cfg.ClientOptions...)
+	c, err := aiplatform.NewPredictionClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize AI client: %w", err)
+	}
+	return &Gemma{
+		c:           c,
+		endpointUri: fmt.Sprintf(modelEndpointTemplate, cfg.ProjectID, cfg.Region, cfg.EndpointID),
+		parameters:  cfg.Parameters,
+	}, nil
+}
+
+func (g *Gemma) Name() string {
+	return g.endpointUri
+}
+
+func (g *Gemma) Close() error {
+	return g.c.Close()
+}
+
+// Generate sends prompt following https://cloud.google.com/vertex-ai/generative-ai/docs/text/test-text-prompts
+func (g *Gemma) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if err := validateTextRequest(req); err != nil {
+		return nil, err
+	}
+	prompt := gemmaPrompt(req)
+	promptValue, err := structpb.NewValue(map[string]interface{}{
+		"inputs": prompt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert prompt %q to Value: %w", prompt, err)
+	}
+	parameters := g.predictParameters(req.Config)
+	parametersValue, err := structpb.NewValue(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert parameters to Value: %w", err)
+	}
+	slog.Debug("predict request data",
+		"endpoint", g.endpointUri,
+		"inputs", prompt,
+		"parameters", fmt.Sprintf("%v", parameters))
+	r := &aiplatformpb.PredictRequest{
+		Endpoint:   g.endpointUri,
+		Instances:  []*structpb.Value{promptValue},
+		Parameters: parametersValue,
+	}
+	resp, err := g.c.Predict(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("model failed to respond: %w", err)
+	}
+	if len(resp.Predictions) == 0 {
+		return nil, fmt.Errorf("model returned empty response: %v", resp)
+	}
+	slog.Debug("predict response data",
+		"response_0", resp.Predictions[0].GetStringValue(),
+		"response_count", len(resp.Predictions),
+		"model", resp.ModelDisplayName,
+		"model_version", resp.ModelVersionId,
+		"metadata", fmt.Sprintf("%v", resp.Metadata))
+	text := gemmaResponse(resp.Predictions[0].GetStringValue())
+	return &Response{
+		Text:         text,
+		Model:        resp.ModelDisplayName,
+		FinishReason: gemmaFinishReason(text),
+	}, nil
+}
+
+// Stream is not supported by the prediction endpoint so the whole response is passed to fn as one chunk.
+func (g *Gemma) Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	resp, err := g.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(resp.Text); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (g *Gemma) predictParameters(cfg GenerationConfig) map[string]interface{} {
+	parameters := make(map[string]interface{}, len(g.parameters)+4)
+	for k, v := range g.parameters {
+		parameters[k] = v
+	}
+	if cfg.Temperature != nil {
+		parameters["temperature"] = *cfg.Temperature
+	}
+	if cfg.TopP != nil {
+		parameters["topP"] = *cfg.TopP
+	}
+	if cfg.TopK != nil {
+		parameters["topK"] = *cfg.TopK
+	}
+	if cfg.MaxOutputTokens != nil {
+		parameters["maxOutputTokens"] = *cfg.MaxOutputTokens
+	}
+	return parameters
+}
+
+func gemmaPrompt(req *Request) string {
+	var b strings.Builder
+	b.WriteString(req.SystemInstruction)
+	b.WriteString("\n")
+	for i, m := range req.Messages {
+		turn := startTurnUser
+		if m.Role == RoleModel {
+			turn = startTurnModel
+		}
+		msg := fmt.Sprintf(chatTurnTemplate, turn, m.Text, endTurn)
+		if i == len(req.Messages)-1 {
+			msg = strings.TrimRight(msg, " \n")
+		}
+		b.WriteString(msg)
+		b.WriteString("\n")
+	}
+	b.WriteString(startTurnModel)
+	return b.String()
+}
+
+// gemmaResponse excludes anything outside model's tags
+func gemmaResponse(response string) string {
+	var pos int
+	pos = strings.LastIndex(response, startTurnModel)
+	if pos >= 0 {
+		response = response[pos+len(startTurnModel):]
+	}
+	pos = strings.LastIndex(response, endTurn)
+	if pos >= 0 {
+		response = response[:pos]
+	}
+	return response
+}
+
+// gemmaFinishReason returns the finish reason of the response text. The prediction endpoint does not report
+// why the model stopped, so the text is assumed complete unless it is empty.
+func gemmaFinishReason(text string) FinishReason {
+	if strings.TrimSpace(text) == "" {
+		return FinishReasonOther
+	}
+	return FinishReasonStop
+}
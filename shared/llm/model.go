@@ -0,0 +1,135 @@
+// Package llm defines a backend agnostic interface to generative models
+// and adapters to the models used by the challenges.
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// Role identifies the author of the message in the conversation.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleModel Role = "model"
+)
+
+// Message is a single turn of the conversation.
+type Message struct {
+	Role Role
+	Text string
+	// Blobs are the files attached to the message, e.g. images or PDFs.
+	// Only Gemini supports them.
+	Blobs []Blob
+}
+
+// Blob is the inline data of the attached file.
+type Blob struct {
+	MIMEType string
+	Data     []byte
+}
+
+// GenerationConfig holds optional generation parameters.
+// Nil fields are not sent to the model, so the backend defaults apply.
+type GenerationConfig struct {
+	Temperature     *float32
+	TopP            *float32
+	TopK            *int32
+	MaxOutputTokens *int32
+	// ResponseMIMEType set to MIMETypeJSON asks for JSON response.
+	// Gemma ignores it, so the prompt has to ask for JSON too.
+	ResponseMIMEType string
+	// ResponseSchema is the structure of the JSON response. It requires ResponseMIMEType.
+	ResponseSchema *Schema
+}
+
+// Request describes a single call to the model.
+// Messages hold the conversation that ends with the user message to respond to.
+type Request struct {
+	SystemInstruction string
+	Messages          []Message
+	Config            GenerationConfig
+	SafetySettings    []SafetySetting
+}
+
+// Usage reports the number of tokens consumed by the call.
+// Backends that do not report usage leave it zero.
+type Usage struct {
+	PromptTokens   int32
+	ResponseTokens int32
+	TotalTokens    int32
+}
+
+// Response is the result of the model call.
+// Blocked responses have no text and the finish reason tells why they were blocked.
+type Response struct {
+	Text          string
+	Model         string
+	Usage         Usage
+	FinishReason  FinishReason
+	SafetyRatings []SafetyRating
+}
+
+// StreamFunc is called with each chunk of the generated text as it arrives.
+// Returning an error stops the stream.
+type StreamFunc func(chunk string) error
+
+// Model sends prompts to a generative model and returns the generated text.
+type Model interface {
+	// Name returns the name of the model that is used in logs and metrics.
+	Name() string
+	// Generate returns the response to the last message of the request.
+	Generate(ctx context.Context, req *Request) (*Response, error)
+	// Stream is like Generate but also passes the generated text to fn as it arrives.
+	Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error)
+	Close() error
+}
+
+// UserMessage returns a request with a single user message.
+func UserMessage(text string) *Request {
+	return &Request{Messages: []Message{{Role: RoleUser, Text: text}}}
+}
+
+// LastUserMessage returns the message the model is asked to respond to.
+func (r *Request) LastUserMessage() *Message {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == RoleUser {
+			return &r.Messages[i]
+		}
+	}
+	return nil
+}
+
+func validateRequest(req *Request) error {
+	if req == nil || len(req.Messages) == 0 {
+		return fmt.Errorf("request has no messages")
+	}
+	if last := req.Messages[len(req.Messages)-1]; last.Role != RoleUser {
+		return fmt.Errorf("last message is from %q and not from user", last.Role)
+	}
+	return nil
+}
+
+// validateTextRequest is like validateRequest but also rejects attachments
+// for the backends that accept only text.
+func validateTextRequest(req *Request) error {
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+	for _, m := range req.Messages {
+		if len(m.Blobs) > 0 {
+			return fmt.Errorf("model does not support attachments")
+		}
+	}
+	return nil
+}
+
+// Ping sends the shortest request to check that the model is reachable.
+func Ping(ctx context.Context, m Model) error {
+	req := UserMessage("ping")
+	maxTokens := int32(1)
+	req.Config.MaxOutputTokens = &maxTokens
+	_, err := m.Generate(ctx, req)
+	return err
+}
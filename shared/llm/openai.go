@@ -0,0 +1,265 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultOpenAIBaseURL = "http://localhost:8000/v1"
+
+// OpenAI calls models served behind OpenAI compatible chat completions API,
+// e.g. self-hosted vLLM or Ollama servers.
+type OpenAI struct {
+	client    *http.Client
+	url       string
+	apiKey    string
+	modelName string
+}
+
+// NewOpenAI uses cfg.BaseURL (e.g. "http://localhost:11434/v1") to call the cfg.ModelName model.
+// The cfg.APIKey is optional for self-hosted servers.
+func NewOpenAI(cfg Config) (*OpenAI, error) {
+	if cfg.ModelName == "" {
+		return nil, fmt.Errorf("openai requires model name")
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &OpenAI{
+		client:    client,
+		url:       strings.TrimRight(baseURL, "/") + "/chat/completions",
+		apiKey:    cfg.APIKey,
+		modelName: cfg.ModelName,
+	}, nil
+}
+
+func (o *OpenAI) Name() string {
+	return o.modelName
+}
+
+func (o *OpenAI) Close() error {
+	return nil
+}
+
+type chatCompletionMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model          string                  `json:"model"`
+	Messages       []chatCompletionMessage `json:"messages"`
+	Temperature    *float32                `json:"temperature,omitempty"`
+	TopP           *float32                `json:"top_p,omitempty"`
+	TopK           *int32                  `json:"top_k,omitempty"`
+	MaxTokens      *int32                  `json:"max_tokens,omitempty"`
+	Stream         bool                    `json:"stream,omitempty"`
+	StreamOptions  *streamOptions          `json:"stream_options,omitempty"`
+	ResponseFormat *responseFormat         `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *jsonSchema `json:"json_schema,omitempty"`
+}
+
+type jsonSchema struct {
+	Name   string  `json:"name"`
+	Schema *Schema `json:"schema"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int32 `json:"prompt_tokens"`
+	CompletionTokens int32 `json:"completion_tokens"`
+	TotalTokens      int32 `json:"total_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      chatCompletionMessage `json:"message"`
+		Delta        chatCompletionMessage `json:"delta"`
+		FinishReason string                `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+}
+
+type chatCompletionError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (o *OpenAI) Generate(ctx context.Context, req *Request) (*Response, error) {
+	httpResp, err := o.post(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var r chatCompletionResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid chat completion response: %w", err)
+	}
+	if len(r.Choices) == 0 {
+		return nil, fmt.Errorf("model has no answer")
+	}
+	resp := o.response(r.Model, r.Choices[0].Message.Content, r.Usage)
+	resp.FinishReason = openAIFinishReason(r.Choices[0].FinishReason)
+	return resp, nil
+}
+
+// Stream reads server-sent events of the streamed chat completion.
+func (o *OpenAI) Stream(ctx context.Context, req *Request, fn StreamFunc) (*Response, error) {
+	httpResp, err := o.post(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var (
+		text   strings.Builder
+		model  string
+		usage  *chatCompletionUsage
+		finish string
+	)
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("invalid chat completion chunk: %w", err)
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			finish = chunk.Choices[0].FinishReason
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+		if err := fn(chunk.Choices[0].Delta.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read chat completion stream: %w", err)
+	}
+	resp := o.response(model, text.String(), usage)
+	resp.FinishReason = openAIFinishReason(finish)
+	return resp, nil
+}
+
+func (o *OpenAI) post(ctx context.Context, req *Request, stream bool) (*http.Response, error) {
+	if err := validateTextRequest(req); err != nil {
+		return nil, err
+	}
+	body := chatCompletionRequest{
+		Model:       o.modelName,
+		Messages:    make([]chatCompletionMessage, 0, len(req.Messages)+1),
+		Temperature: req.Config.Temperature,
+		TopP:        req.Config.TopP,
+		TopK:        req.Config.TopK,
+		MaxTokens:   req.Config.MaxOutputTokens,
+		Stream:      stream,
+	}
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if req.Config.ResponseMIMEType == MIMETypeJSON {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+		if req.Config.ResponseSchema != nil {
+			body.ResponseFormat = &responseFormat{
+				Type:       "json_schema",
+				JSONSchema: &jsonSchema{Name: "response", Schema: req.Config.ResponseSchema},
+			}
+		}
+	}
+	if req.SystemInstruction != "" {
+		body.Messages = append(body.Messages, chatCompletionMessage{Role: "system", Content: req.SystemInstruction})
+	}
+	for _, m := range req.Messages {
+		role := "user"
+		if m.Role == RoleModel {
+			role = "assistant"
+		}
+		body.Messages = append(body.Messages, chatCompletionMessage{Role: role, Content: m.Text})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal chat completion request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("model failed to respond: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		return nil, responseError(httpResp)
+	}
+	return httpResp, nil
+}
+
+func (o *OpenAI) response(model, text string, usage *chatCompletionUsage) *Response {
+	if model == "" {
+		model = o.modelName
+	}
+	r := &Response{Text: text, Model: model}
+	if usage != nil {
+		r.Usage = Usage{
+			PromptTokens:   usage.PromptTokens,
+			ResponseTokens: usage.CompletionTokens,
+			TotalTokens:    usage.TotalTokens,
+		}
+	}
+	return r
+}
+
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e chatCompletionError
+	if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+		return fmt.Errorf("model failed to respond: %s: %w", resp.Status, errors.New(e.Error.Message))
+	}
+	return fmt.Errorf("model failed to respond: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+}
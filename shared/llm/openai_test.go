@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestOpenAI returns the model that calls the handler. The handler gets the decoded request body.
+func newTestOpenAI(t *testing.T, handler func(w http.ResponseWriter, body chatCompletionRequest)) *OpenAI {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+		}
+		var body chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		handler(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	m, err := NewOpenAI(Config{BaseURL: srv.URL + "/v1/", ModelName: "gemma2:9b", APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestOpenAIGenerate(t *testing.T) {
+	var got chatCompletionRequest
+	m := newTestOpenAI(t, func(w http.ResponseWriter, body chatCompletionRequest) {
+		got = body
+		io.WriteString(w, `{"model": "gemma2:9b-instruct", "choices": [{"message": {"role": "assistant", "content": "Visit the Colosseum."}, "finish_reason": "length"}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 4, "total_tokens": 16}}`)
+	})
+	temperature, maxTokens := float32(0.2), int32(64)
+	req := &Request{
+		SystemInstruction: "Be brief.",
+		Messages: []Message{
+			{Role: RoleUser, Text: "Plan a day in Rome"},
+			{Role: RoleModel, Text: "Sure."},
+			{Role: RoleUser, Text: "What to see first?"},
+		},
+		Config: GenerationConfig{Temperature: &temperature, MaxOutputTokens: &maxTokens},
+	}
+	resp, err := m.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Visit the Colosseum." || resp.Model != "gemma2:9b-instruct" || resp.FinishReason != FinishReasonMaxTokens {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, ResponseTokens: 4, TotalTokens: 16}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+	wantRoles := []string{"system", "user", "assistant", "user"}
+	if len(got.Messages) != len(wantRoles) {
+		t.Fatalf("request messages = %+v", got.Messages)
+	}
+	for i, role := range wantRoles {
+		if got.Messages[i].Role != role {
+			t.Errorf("message %d role = %q, want %q", i, got.Messages[i].Role, role)
+		}
+	}
+	if got.Model != "gemma2:9b" || got.Stream || got.Temperature == nil || *got.Temperature != temperature || got.MaxTokens == nil || *got.MaxTokens != maxTokens {
+		t.Errorf("request = %+v", got)
+	}
+	if got.ResponseFormat != nil {
+		t.Errorf("response_format = %+v, want none", got.ResponseFormat)
+	}
+}
+
+func TestOpenAIResponseFormat(t *testing.T) {
+	schema := &Schema{
+		Type:       TypeObject,
+		Properties: map[string]*Schema{"city": {Type: TypeString}},
+		Required:   []string{"city"},
+	}
+	tests := []struct {
+		name       string
+		config     GenerationConfig
+		wantType   string
+		wantSchema bool
+	}{
+		{"text", GenerationConfig{}, "", false},
+		{"json", GenerationConfig{ResponseMIMEType: MIMETypeJSON}, "json_object", false},
+		{"json schema", GenerationConfig{ResponseMIMEType: MIMETypeJSON, ResponseSchema: schema}, "json_schema", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got chatCompletionRequest
+			m := newTestOpenAI(t, func(w http.ResponseWriter, body chatCompletionRequest) {
+				got = body
+				io.WriteString(w, `{"choices": [{"message": {"content": "{\"city\": \"Rome\"}"}, "finish_reason": "stop"}]}`)
+			})
+			req := UserMessage("Where is the Colosseum?")
+			req.Config = tc.config
+			if _, err := m.Generate(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantType == "" {
+				if got.ResponseFormat != nil {
+					t.Errorf("response_format = %+v, want none", got.ResponseFormat)
+				}
+				return
+			}
+			if got.ResponseFormat == nil || got.ResponseFormat.Type != tc.wantType {
+				t.Fatalf("response_format = %+v, want type %q", got.ResponseFormat, tc.wantType)
+			}
+			if !tc.wantSchema {
+				if got.ResponseFormat.JSONSchema != nil {
+					t.Errorf("json_schema = %+v, want none", got.ResponseFormat.JSONSchema)
+				}
+				return
+			}
+			s := got.ResponseFormat.JSONSchema
+			if s == nil || s.Name == "" || s.Schema == nil || s.Schema.Type != TypeObject || s.Schema.Properties["city"] == nil || len(s.Schema.Required) != 1 {
+				t.Errorf("json_schema = %+v", s)
+			}
+		})
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []string
+		wantChunks []string
+		wantText   string
+		wantFinish FinishReason
+		wantUsage  Usage
+		wantErr    bool
+	}{
+		{
+			name: "chunks with usage",
+			events: []string{
+				`: keep-alive comment`,
+				`data: {"model": "gemma2:9b", "choices": [{"delta": {"role": "assistant"}}]}`,
+				`data: {"choices": [{"delta": {"content": "Visit "}}]}`,
+				`data:{"choices": [{"delta": {"content": "Rome."}, "finish_reason": "stop"}]}`,
+				`data: {"choices": [], "usage": {"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7}}`,
+				`data: [DONE]`,
+				`data: {"choices": [{"delta": {"content": " ignored after done"}}]}`,
+			},
+			wantChunks: []string{"Visit ", "Rome."},
+			wantText:   "Visit Rome.",
+			wantFinish: FinishReasonStop,
+			wantUsage:  Usage{PromptTokens: 5, ResponseTokens: 2, TotalTokens: 7},
+		},
+		{
+			name: "content filter",
+			events: []string{
+				`data: {"choices": [{"delta": {"content": "Visit"}, "finish_reason": "content_filter"}]}`,
+				`data: [DONE]`,
+			},
+			wantChunks: []string{"Visit"},
+			wantText:   "Visit",
+			wantFinish: FinishReasonSafety,
+		},
+		{
+			name: "malformed chunk",
+			events: []string{
+				`data: {"choices": [{"delta": {"content": "Visit "}}]}`,
+				`data: {"choices": [`,
+				`data: [DONE]`,
+			},
+			wantChunks: []string{"Visit "},
+			wantErr:    true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestOpenAI(t, func(w http.ResponseWriter, body chatCompletionRequest) {
+				if !body.Stream || body.StreamOptions == nil || !body.StreamOptions.IncludeUsage {
+					t.Errorf("request stream = %v, stream_options = %+v", body.Stream, body.StreamOptions)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, e := range tc.events {
+					fmt.Fprintf(w, "%s\n\n", e)
+				}
+			})
+			var chunks []string
+			resp, err := m.Stream(context.Background(), UserMessage("Plan a day in Rome"), func(chunk string) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+			if strings.Join(chunks, "|") != strings.Join(tc.wantChunks, "|") {
+				t.Errorf("chunks = %q, want %q", chunks, tc.wantChunks)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Stream() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text != tc.wantText || resp.FinishReason != tc.wantFinish || resp.Usage != tc.wantUsage || resp.Model != "gemma2:9b" {
+				t.Errorf("response = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestOpenAIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"json error", http.StatusBadRequest, `{"error": {"message": "model gemma2:9b not found"}}`, "400 Bad Request: model gemma2:9b not found"},
+		{"text error", http.StatusBadGateway, "upstream is down\n", "502 Bad Gateway: upstream is down"},
+		{"empty json error", http.StatusTooManyRequests, `{"error": {}}`, `429 Too Many Requests: {"error": {}}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestOpenAI(t, func(w http.ResponseWriter, _ chatCompletionRequest) {
+				w.WriteHeader(tc.status)
+				io.WriteString(w, tc.body)
+			})
+			_, err := m.Generate(context.Background(), UserMessage("Plan a day in Rome"))
+			if err == nil || !strings.HasSuffix(err.Error(), tc.wantErr) {
+				t.Errorf("Generate() error = %v, want suffix %q", err, tc.wantErr)
+			}
+			_, err = m.Stream(context.Background(), UserMessage("Plan a day in Rome"), func(string) error { return nil })
+			if err == nil || !strings.HasSuffix(err.Error(), tc.wantErr) {
+				t.Errorf("Stream() error = %v, want suffix %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+)
+
+// FinishReason tells why the model stopped generating the response.
+// Backends that do not report it leave it empty.
+type FinishReason string
+
+const (
+	FinishReasonUnspecified FinishReason = ""
+	FinishReasonStop        FinishReason = "stop"
+	// FinishReasonMaxTokens means that the response is truncated.
+	FinishReasonMaxTokens FinishReason = "max_tokens"
+	// FinishReasonSafety means that the response was blocked by safety filters.
+	FinishReasonSafety FinishReason = "safety"
+	// FinishReasonRecitation means that the response was blocked because it recited copyrighted content.
+	FinishReasonRecitation FinishReason = "recitation"
+	// FinishReasonPromptBlocked means that the model refused to process the prompt.
+	FinishReasonPromptBlocked FinishReason = "prompt_blocked"
+	FinishReasonOther         FinishReason = "other"
+	// FinishReasonRefused means that a guardrail refused the request without calling the model.
+	FinishReasonRefused FinishReason = "refused"
+)
+
+// Blocked reports whether the response was withheld by the model.
+func (r FinishReason) Blocked() bool {
+	return r == FinishReasonSafety || r == FinishReasonRecitation || r == FinishReasonPromptBlocked
+}
+
+// HarmCategory is the category of harmful content that is filtered by Gemini.
+type HarmCategory string
+
+const (
+	HarmCategoryHarassment       HarmCategory = "harassment"
+	HarmCategoryHateSpeech       HarmCategory = "hate_speech"
+	HarmCategorySexuallyExplicit HarmCategory = "sexually_explicit"
+	HarmCategoryDangerousContent HarmCategory = "dangerous_content"
+)
+
+// HarmBlockThreshold is the probability of harm starting from which the content is blocked.
+type HarmBlockThreshold string
+
+const (
+	HarmBlockLowAndAbove    HarmBlockThreshold = "block_low_and_above"
+	HarmBlockMediumAndAbove HarmBlockThreshold = "block_medium_and_above"
+	HarmBlockOnlyHigh       HarmBlockThreshold = "block_only_high"
+	HarmBlockNone           HarmBlockThreshold = "block_none"
+)
+
+var (
+	harmCategories = map[HarmCategory]genai.HarmCategory{
+		HarmCategoryHarassment:       genai.HarmCategoryHarassment,
+		HarmCategoryHateSpeech:       genai.HarmCategoryHateSpeech,
+		HarmCategorySexuallyExplicit: genai.HarmCategorySexuallyExplicit,
+		HarmCategoryDangerousContent: genai.HarmCategoryDangerousContent,
+	}
+	harmBlockThresholds = map[HarmBlockThreshold]genai.HarmBlockThreshold{
+		HarmBlockLowAndAbove:    genai.HarmBlockLowAndAbove,
+		HarmBlockMediumAndAbove: genai.HarmBlockMediumAndAbove,
+		HarmBlockOnlyHigh:       genai.HarmBlockOnlyHigh,
+		HarmBlockNone:           genai.HarmBlockNone,
+	}
+)
+
+// SafetySetting sets the block threshold for the harm category.
+// Only Gemini supports safety settings; other backends ignore them.
+type SafetySetting struct {
+	Category  HarmCategory
+	Threshold HarmBlockThreshold
+}
+
+// SafetyRating is the harm probability of the response in the category.
+type SafetyRating struct {
+	Category    string
+	Probability string
+	Blocked     bool
+}
+
+// ParseSafetySettings parses the comma separated list of category=threshold pairs,
+// e.g. "harassment=block_only_high,dangerous_content=block_low_and_above".
+func ParseSafetySettings(s string) ([]SafetySetting, error) {
+	var settings []SafetySetting
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		category, threshold, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid safety setting %q: expected category=threshold", pair)
+		}
+		setting := SafetySetting{
+			Category:  HarmCategory(strings.ToLower(strings.TrimSpace(category))),
+			Threshold: HarmBlockThreshold(strings.ToLower(strings.TrimSpace(threshold))),
+		}
+		if _, ok := harmCategories[setting.Category]; !ok {
+			return nil, fmt.Errorf("unsupported harm category %q", category)
+		}
+		if _, ok := harmBlockThresholds[setting.Threshold]; !ok {
+			return nil, fmt.Errorf("unsupported harm block threshold %q", threshold)
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+func geminiSafetySettings(settings []SafetySetting) []*genai.SafetySetting {
+	var result []*genai.SafetySetting
+	for _, s := range settings {
+		result = append(result, &genai.SafetySetting{
+			Category:  harmCategories[s.Category],
+			Threshold: harmBlockThresholds[s.Threshold],
+		})
+	}
+	return result
+}
+
+func geminiFinishReason(r genai.FinishReason) FinishReason {
+	switch r {
+	case genai.FinishReasonUnspecified:
+		return FinishReasonUnspecified
+	case genai.FinishReasonStop:
+		return FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return FinishReasonMaxTokens
+	case genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonProhibitedContent, genai.FinishReasonSpii:
+		return FinishReasonSafety
+	case genai.FinishReasonRecitation:
+		return FinishReasonRecitation
+	default:
+		return FinishReasonOther
+	}
+}
+
+func geminiSafetyRatings(ratings []*genai.SafetyRating) []SafetyRating {
+	var result []SafetyRating
+	for _, r := range ratings {
+		if r == nil {
+			continue
+		}
+		result = append(result, SafetyRating{
+			Category:    r.Category.String(),
+			Probability: r.Probability.String(),
+			Blocked:     r.Blocked,
+		})
+	}
+	return result
+}
+
+func openAIFinishReason(r string) FinishReason {
+	switch r {
+	case "":
+		return FinishReasonUnspecified
+	case "stop":
+		return FinishReasonStop
+	case "length":
+		return FinishReasonMaxTokens
+	case "content_filter":
+		return FinishReasonSafety
+	default:
+		return FinishReasonOther
+	}
+}
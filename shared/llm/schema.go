@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"cloud.google.com/go/vertexai/genai"
+)
+
+// MIMETypeJSON asks the model to respond with JSON.
+const MIMETypeJSON = "application/json"
+
+// Schema types. They are the same as JSON Schema types.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+	TypeObject  = "object"
+)
+
+// Schema describes the structure of the JSON response. It is a subset of JSON Schema
+// that is supported by Gemini and by OpenAI compatible servers.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+var geminiTypes = map[string]genai.Type{
+	TypeString:  genai.TypeString,
+	TypeNumber:  genai.TypeNumber,
+	TypeInteger: genai.TypeInteger,
+	TypeBoolean: genai.TypeBoolean,
+	TypeArray:   genai.TypeArray,
+	TypeObject:  genai.TypeObject,
+}
+
+func geminiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	gs := &genai.Schema{
+		Type:        geminiTypes[s.Type],
+		Description: s.Description,
+		Format:      s.Format,
+		Nullable:    s.Nullable,
+		Enum:        s.Enum,
+		Items:       geminiSchema(s.Items),
+		Required:    s.Required,
+	}
+	if len(s.Properties) > 0 {
+		gs.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			gs.Properties[name] = geminiSchema(p)
+		}
+	}
+	return gs
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	indexFile = "index.html"
+	// immutableCache is used for the content-hashed URLs that change when the content changes
+	immutableCache = "public, max-age=31536000, immutable"
+	// revalidateCache makes browsers check ETag before using the cached copy
+	revalidateCache = "no-cache"
+)
+
+// assetRef matches the local URLs in src and href attributes of HTML files.
+var assetRef = regexp.MustCompile(`(src|href)=(["'])([^"':?#]+)(["'])`)
+
+type asset struct {
+	name      string
+	data      []byte
+	etag      string
+	immutable bool
+}
+
+// Assets serves the static files of the web UI.
+// The files are read once from the embedded file system. Each file except HTML is also served at
+// the URL with the hash of its content, e.g. script.0a1b2c3d4e.js, that is cached by browsers forever.
+// HTML files refer to the hashed URLs and are revalidated with ETag.
+// When the directory is set, the files are read from disk on each request without hashing,
+// so the changes are visible after reloading the page.
+type Assets struct {
+	dir   fs.FS
+	files map[string]*asset
+}
+
+// NewAssets returns the assets of the embedded file system or of the directory if it is not empty.
+func NewAssets(embedded fs.FS, dir string) (*Assets, error) {
+	if dir != "" {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("static files directory %q is not found: %w", dir, err)
+		}
+		return &Assets{dir: os.DirFS(dir)}, nil
+	}
+	a := &Assets{files: make(map[string]*asset)}
+	hashed := make(map[string]string)
+	err := fs.WalkDir(embedded, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(embedded, name)
+		if err != nil {
+			return err
+		}
+		f := newAsset(name, data)
+		a.files[name] = f
+		if path.Ext(name) != ".html" {
+			h := hashedName(name, f.etag)
+			a.files[h] = &asset{name: name, data: data, etag: f.etag, immutable: true}
+			hashed[name] = h
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, f := range a.files {
+		if path.Ext(name) == ".html" {
+			a.files[name] = newAsset(name, rewriteRefs(name, f.data, hashed))
+		}
+	}
+	return a, nil
+}
+
+// Middleware serves the assets for GET and HEAD requests. Other requests and unknown paths are passed
+// to the next handler. Paths that are not found by the next handler get index.html.
+func (a *Assets) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return next(c)
+			}
+			name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+			if name == "" {
+				name = indexFile
+			}
+			if f := a.lookup(name); f != nil {
+				return serveAsset(c, f)
+			}
+			err := next(c)
+			var he *echo.HTTPError
+			if errors.As(err, &he) && he.Code == http.StatusNotFound {
+				if f := a.lookup(indexFile); f != nil {
+					return serveAsset(c, f)
+				}
+			}
+			return err
+		}
+	}
+}
+
+func (a *Assets) lookup(name string) *asset {
+	if a.dir == nil {
+		return a.files[name]
+	}
+	data, err := fs.ReadFile(a.dir, name)
+	if err != nil {
+		return nil
+	}
+	return newAsset(name, data)
+}
+
+func serveAsset(c echo.Context, f *asset) error {
+	h := c.Response().Header()
+	h.Set("ETag", f.etag)
+	if f.immutable {
+		h.Set(echo.HeaderCacheControl, immutableCache)
+	} else {
+		h.Set(echo.HeaderCacheControl, revalidateCache)
+	}
+	// ServeContent responds 304 to the matching If-None-Match and sets Content-Type from the file extension
+	http.ServeContent(c.Response(), c.Request(), f.name, time.Time{}, bytes.NewReader(f.data))
+	return nil
+}
+
+func newAsset(name string, data []byte) *asset {
+	sum := sha256.Sum256(data)
+	return &asset{name: name, data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+}
+
+// hashedName inserts the first characters of the hash before the extension of the name.
+func hashedName(name, etag string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + strings.Trim(etag, `"`)[:10] + ext
+}
+
+// rewriteRefs replaces the local URLs in the HTML file with the hashed URLs.
+func rewriteRefs(name string, data []byte, hashed map[string]string) []byte {
+	dir := path.Dir(name)
+	return assetRef.ReplaceAllFunc(data, func(m []byte) []byte {
+		g := assetRef.FindSubmatch(m)
+		ref := string(g[3])
+		target := path.Join(dir, ref)
+		if strings.HasPrefix(ref, "/") {
+			target = strings.TrimPrefix(path.Clean(ref), "/")
+		}
+		h, ok := hashed[target]
+		if !ok {
+			return m
+		}
+		url := path.Join(path.Dir(ref), path.Base(h))
+		if strings.HasPrefix(ref, "/") {
+			url = "/" + h
+		}
+		return []byte(fmt.Sprintf("%s=%s%s%s", g[1], g[2], url, g[4]))
+	})
+}
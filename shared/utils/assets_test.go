@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+)
+
+var testAssets = fstest.MapFS{
+	"index.html":     {Data: []byte(`<link href="style.css" rel="stylesheet"><script src="/js/app.js"></script><a href="https://example.com/x.js">x</a><img src='missing.png'><a href="about.html">about</a>`)},
+	"about.html":     {Data: []byte(`<script src="js/app.js"></script>`)},
+	"style.css":      {Data: []byte("body { color: black; }")},
+	"js/app.js":      {Data: []byte("console.log('app');")},
+	"pages/faq.html": {Data: []byte(`<link href="../style.css"><script src="/js/app.js?v=1"></script>`)},
+}
+
+func newTestAssets(t *testing.T, dir string) *echo.Echo {
+	t.Helper()
+	a, err := NewAssets(testAssets, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(a.Middleware())
+	e.GET("/api", func(c echo.Context) error { return c.String(http.StatusOK, "api") })
+	return e
+}
+
+func get(e *echo.Echo, method, url string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+var hashedRef = regexp.MustCompile(`(?:src|href)=["']([^"']+)["']`)
+
+func refs(body string) []string {
+	var list []string
+	for _, m := range hashedRef.FindAllStringSubmatch(body, -1) {
+		list = append(list, m[1])
+	}
+	return list
+}
+
+func TestAssetsHashedURLs(t *testing.T) {
+	e := newTestAssets(t, "")
+	rec := get(e, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d", rec.Code)
+	}
+	got := refs(rec.Body.String())
+	if len(got) != 5 {
+		t.Fatalf("index.html refers to %q", got)
+	}
+	style, app := got[0], got[1]
+	if !regexp.MustCompile(`^style\.[0-9a-f]{10}\.css$`).MatchString(style) {
+		t.Errorf("style.css is referred as %q", style)
+	}
+	if !regexp.MustCompile(`^/js/app\.[0-9a-f]{10}\.js$`).MatchString(app) {
+		t.Errorf("/js/app.js is referred as %q", app)
+	}
+	// external URLs, unknown files and HTML pages are not rewritten
+	if want := []string{"https://example.com/x.js", "missing.png", "about.html"}; strings.Join(got[2:], " ") != strings.Join(want, " ") {
+		t.Errorf("other references = %q, want %q", got[2:], want)
+	}
+
+	// the relative references are resolved against the directory of the page
+	about := refs(get(e, http.MethodGet, "/about.html", nil).Body.String())
+	if len(about) != 1 || "/"+about[0] != app {
+		t.Errorf("about.html refers to %q, want %q", about, app[1:])
+	}
+	faq := refs(get(e, http.MethodGet, "/pages/faq.html", nil).Body.String())
+	if len(faq) != 2 || faq[0] != "../"+style || faq[1] != "/js/app.js?v=1" {
+		t.Errorf("pages/faq.html refers to %q", faq)
+	}
+
+	// the hashed URLs serve the content with the immutable cache
+	for url, want := range map[string]string{"/" + style: "body { color: black; }", app: "console.log('app');"} {
+		rec := get(e, http.MethodGet, url, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q, want %q", url, rec.Code, rec.Body.String(), want)
+		}
+		if cc := rec.Header().Get(echo.HeaderCacheControl); cc != immutableCache {
+			t.Errorf("GET %s Cache-Control = %q, want %q", url, cc, immutableCache)
+		}
+	}
+	if ct := get(e, http.MethodGet, app, nil).Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("GET %s Content-Type = %q", app, ct)
+	}
+}
+
+func TestAssetsCacheHeaders(t *testing.T) {
+	e := newTestAssets(t, "")
+	for _, url := range []string{"/", "/index.html", "/style.css", "/js/app.js"} {
+		rec := get(e, http.MethodGet, url, nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", url, rec.Code)
+			continue
+		}
+		if cc := rec.Header().Get(echo.HeaderCacheControl); cc != revalidateCache {
+			t.Errorf("GET %s Cache-Control = %q, want %q", url, cc, revalidateCache)
+		}
+		if etag := rec.Header().Get("ETag"); !regexp.MustCompile(`^"[0-9a-f]{16}"$`).MatchString(etag) {
+			t.Errorf("GET %s ETag = %q", url, etag)
+		}
+	}
+	if rec := get(e, http.MethodHead, "/style.css", nil); rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("HEAD /style.css = %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestAssetsETag(t *testing.T) {
+	e := newTestAssets(t, "")
+	for _, url := range []string{"/", "/style.css"} {
+		etag := get(e, http.MethodGet, url, nil).Header().Get("ETag")
+		rec := get(e, http.MethodGet, url, map[string]string{"If-None-Match": etag})
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("GET %s with matching If-None-Match = %d with %d bytes, want 304", url, rec.Code, rec.Body.Len())
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("GET %s 304 ETag = %q, want %q", url, got, etag)
+		}
+		rec = get(e, http.MethodGet, url, map[string]string{"If-None-Match": `"0000000000000000"`})
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("GET %s with other If-None-Match = %d, want 200", url, rec.Code)
+		}
+	}
+	// the ETag of the page changes with the content of the files it refers to
+	index := get(e, http.MethodGet, "/", nil).Header().Get("ETag")
+	if want := newAsset(indexFile, testAssets[indexFile].Data).etag; index == want {
+		t.Error("ETag of index.html is the hash of the page before the URLs are rewritten")
+	}
+}
+
+func TestAssetsFallback(t *testing.T) {
+	e := newTestAssets(t, "")
+	if rec := get(e, http.MethodGet, "/api", nil); rec.Body.String() != "api" {
+		t.Errorf("GET /api = %q, want the handler response", rec.Body.String())
+	}
+	// unknown paths get the index page, so the client side routes work
+	rec := get(e, http.MethodGet, "/trips/rome", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<script") {
+		t.Errorf("GET /trips/rome = %d %q, want index.html", rec.Code, rec.Body.String())
+	}
+	if rec := get(e, http.MethodPost, "/style.css", nil); rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /style.css = %d, want the router response", rec.Code)
+	}
+	// the path cannot escape the assets
+	if rec := get(e, http.MethodGet, "/../style.css", nil); rec.Body.String() != "body { color: black; }" {
+		t.Errorf("GET /../style.css = %q", rec.Body.String())
+	}
+}
+
+func TestAssetsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script src="app.js"></script>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := newTestAssets(t, dir)
+	// the files of the directory are served as they are
+	if rec := get(e, http.MethodGet, "/", nil); rec.Body.String() != `<script src="app.js"></script>` {
+		t.Errorf("GET / = %q", rec.Body.String())
+	}
+	if rec := get(e, http.MethodGet, "/style.css", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<script") {
+		t.Errorf("GET /style.css = %d %q, want index.html of the directory", rec.Code, rec.Body.String())
+	}
+	// the changes are visible without restart
+	first := get(e, http.MethodGet, "/app.js", nil)
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	second := get(e, http.MethodGet, "/app.js", nil)
+	if first.Body.String() != "v1" || second.Body.String() != "v2" {
+		t.Errorf("GET /app.js = %q and %q, want v1 and v2", first.Body.String(), second.Body.String())
+	}
+	if first.Header().Get("ETag") == second.Header().Get("ETag") {
+		t.Error("ETag is not changed with the content")
+	}
+	if cc := second.Header().Get(echo.HeaderCacheControl); cc != revalidateCache {
+		t.Errorf("Cache-Control = %q, want %q", cc, revalidateCache)
+	}
+
+	if _, err := NewAssets(testAssets, filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewAssets() of missing directory succeeded")
+	}
+}
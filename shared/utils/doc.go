@@ -0,0 +1,3 @@
+// Package utils implements the plumbing that the services share: discovery of the project and region
+// from the metadata server, environment variables, logging, the web server bootstrap and the file watcher.
+package utils
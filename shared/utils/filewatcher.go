@@ -0,0 +1,344 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch modes.
+const (
+	// WatchAuto uses file system events unless a watched path is on a network or FUSE file system
+	WatchAuto = "auto"
+	// WatchEvents uses file system events (inotify on Linux)
+	WatchEvents = "events"
+	// WatchPolling checks the files every Interval
+	WatchPolling = "polling"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultDebounce = 500 * time.Millisecond
+)
+
+// OnChangeCallback is called with the path of the changed file.
+// For watched directories it is the path of the changed file in the directory.
+type OnChangeCallback func(path string)
+
+// FileWatcher calls the callback when the watched files or the files in the watched directories are
+// written, created or replaced. Removed files are reported when they are created again.
+// Directories are not watched recursively.
+type FileWatcher struct {
+	// Mode is WatchAuto, WatchEvents or WatchPolling
+	Mode string
+	// Interval is the polling interval. In the events mode it is the interval of attempts
+	// to watch a directory again after it was removed.
+	Interval time.Duration
+	// Debounce is the time without events or, in the polling mode, without changes after which the changes are reported
+	Debounce time.Duration
+
+	files []string
+	dirs  []string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewFileWatcher returns the watcher of the files and directories. The paths must exist.
+func NewFileWatcher(paths ...string) (*FileWatcher, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no paths to watch")
+	}
+	w := &FileWatcher{Mode: WatchAuto, Interval: defaultInterval, Debounce: defaultDebounce}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			w.dirs = append(w.dirs, filepath.Clean(p))
+		} else {
+			w.files = append(w.files, filepath.Clean(p))
+		}
+	}
+	return w, nil
+}
+
+// Watch starts watching in the background until ctx is cancelled or Stop is called.
+// Calling Watch again restarts watching with the new callback.
+func (w *FileWatcher) Watch(ctx context.Context, fn OnChangeCallback) {
+	w.Stop()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		if w.useEvents() {
+			err := w.watchEvents(ctx, fn)
+			if err == nil {
+				return
+			}
+			slog.Warn("cannot watch file system events, falling back to polling", "error", err)
+		}
+		w.poll(ctx, fn)
+	}(w.done)
+}
+
+// Stop stops watching and waits for the running callback to return.
+// It can be called more than once but not from the callback.
+func (w *FileWatcher) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel, w.done = nil, nil
+	w.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (w *FileWatcher) useEvents() bool {
+	switch w.Mode {
+	case WatchEvents:
+		return true
+	case WatchPolling:
+		return false
+	case WatchAuto, "":
+	default:
+		slog.Warn("unknown watch mode, using auto", "mode", w.Mode)
+	}
+	for _, p := range slices.Concat(w.files, w.dirs) {
+		if fsType, ok := remoteFileSystem(p); ok {
+			slog.Debug("watched path is on remote file system, using polling", "path", p, "fs_type", fsType)
+			return false
+		}
+	}
+	return true
+}
+
+// watchEvents reports changes using file system events. It returns an error if the events are not available.
+// The files are watched through their directories, so atomic replacements and recreated files are not missed.
+func (w *FileWatcher) watchEvents(ctx context.Context, fn OnChangeCallback) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	watched := w.watchedDirs()
+	for _, dir := range watched {
+		if err := fw.Add(dir); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+	}
+	seen := w.snapshot()
+	pending := make(map[string]bool)
+	lost := make(map[string]bool)
+	debounce := time.NewTimer(w.Debounce)
+	debounce.Stop()
+	retry := time.NewTicker(w.interval())
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			debounce.Stop()
+			return nil
+		case event, ok := <-fw.Events:
+			if !ok {
+				return errors.New("file system events channel is closed")
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) {
+				continue
+			}
+			name := filepath.Clean(event.Name)
+			if slices.Contains(watched, name) && event.Has(fsnotify.Remove|fsnotify.Rename) {
+				slog.Debug("watched directory is removed", "path", name)
+				lost[name] = true
+				continue
+			}
+			for _, p := range w.affected(name) {
+				pending[p] = true
+			}
+			debounce.Reset(w.Debounce)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return errors.New("file system errors channel is closed")
+			}
+			slog.Error("file system watcher error. continue watching", "error", err)
+		case <-retry.C:
+			for dir := range lost {
+				if err := fw.Add(dir); err != nil {
+					continue
+				}
+				slog.Debug("watched directory is recreated", "path", dir)
+				delete(lost, dir)
+				for _, p := range w.inDir(dir, seen) {
+					pending[p] = true
+				}
+				debounce.Reset(w.Debounce)
+			}
+		case <-debounce.C:
+			w.report(pending, seen, fn)
+			clear(pending)
+		}
+	}
+}
+
+// poll reports changes by comparing the state of the files every interval. Like the events, the changes
+// are reported after Debounce without changes, so a file that is being written is not reported half-written.
+func (w *FileWatcher) poll(ctx context.Context, fn OnChangeCallback) {
+	seen := w.snapshot()
+	// polled is the state of the files at the last tick
+	polled := maps.Clone(seen)
+	pending := make(map[string]bool)
+	debounce := time.NewTimer(w.Debounce)
+	debounce.Stop()
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			debounce.Stop()
+			return
+		case <-ticker.C:
+			paths := slices.Clone(w.files)
+			for _, dir := range w.dirs {
+				paths = append(paths, w.inDir(dir, polled)...)
+			}
+			for _, p := range paths {
+				if changed(p, polled) {
+					pending[p] = true
+					debounce.Reset(w.Debounce)
+				}
+			}
+		case <-debounce.C:
+			w.report(pending, seen, fn)
+			clear(pending)
+		}
+	}
+}
+
+func (w *FileWatcher) interval() time.Duration {
+	if w.Interval <= 0 {
+		return defaultInterval
+	}
+	return w.Interval
+}
+
+// watchedDirs returns the watched directories and the directories of the watched files.
+func (w *FileWatcher) watchedDirs() []string {
+	dirs := slices.Clone(w.dirs)
+	for _, f := range w.files {
+		if dir := filepath.Dir(f); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// affected returns the paths that can be changed by the event for the name.
+// All watched files in the directory are checked because the file can be a symbolic link
+// that is changed by replacing its target, e.g. Kubernetes ConfigMap volumes.
+func (w *FileWatcher) affected(name string) []string {
+	dir := filepath.Dir(name)
+	var paths []string
+	for _, f := range w.files {
+		if filepath.Dir(f) == dir {
+			paths = append(paths, f)
+		}
+	}
+	if slices.Contains(w.dirs, dir) && !slices.Contains(paths, name) {
+		paths = append(paths, name)
+	}
+	return paths
+}
+
+// inDir returns the watched files in the directory or, if the directory is watched, all its files
+// including the ones that were seen before and are removed now.
+func (w *FileWatcher) inDir(dir string, seen map[string]fs.FileInfo) []string {
+	var paths []string
+	for _, f := range w.files {
+		if filepath.Dir(f) == dir {
+			paths = append(paths, f)
+		}
+	}
+	if !slices.Contains(w.dirs, dir) {
+		return paths
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("cannot read watched directory. continue watching", "error", err, "path", dir)
+	}
+	for _, e := range entries {
+		if p := filepath.Join(dir, e.Name()); !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	for p := range seen {
+		if filepath.Dir(p) == dir && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// snapshot returns the current state of the watched files.
+func (w *FileWatcher) snapshot() map[string]fs.FileInfo {
+	seen := make(map[string]fs.FileInfo)
+	for _, dir := range w.watchedDirs() {
+		for _, p := range w.inDir(dir, seen) {
+			changed(p, seen)
+		}
+	}
+	return seen
+}
+
+// report calls the callback for the pending paths that changed since they were seen last time.
+func (w *FileWatcher) report(pending map[string]bool, seen map[string]fs.FileInfo, fn OnChangeCallback) {
+	paths := make([]string, 0, len(pending))
+	for p := range pending {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	for _, p := range paths {
+		if changed(p, seen) {
+			fn(p)
+		}
+	}
+}
+
+// changed updates the state of the file in seen and reports whether the file was created or modified.
+// Removed files and directories are never reported.
+func changed(path string, seen map[string]fs.FileInfo) bool {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, ok := seen[path]; ok {
+			slog.Debug("watched file is removed", "path", path)
+			delete(seen, path)
+		}
+		return false
+	}
+	if err != nil {
+		slog.Error("cannot access file. continue watching", "error", err, "path", path)
+		return false
+	}
+	if fi.IsDir() {
+		return false
+	}
+	prev, ok := seen[path]
+	seen[path] = fi
+	return !ok || fi.Size() != prev.Size() || !fi.ModTime().Equal(prev.ModTime()) || !os.SameFile(fi, prev)
+}
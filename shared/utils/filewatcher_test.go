@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testInterval = 50 * time.Millisecond
+	testDebounce = 50 * time.Millisecond
+	// testWait is the time to wait for a change that must be reported
+	testWait = 3 * time.Second
+	// testQuiet is the time without changes that must not be reported
+	testQuiet = 400 * time.Millisecond
+)
+
+// changes collects the reported paths.
+type changes struct {
+	mu    sync.Mutex
+	paths []string
+	c     chan string
+}
+
+func newChanges() *changes {
+	return &changes{c: make(chan string, 100)}
+}
+
+func (c *changes) callback(path string) {
+	c.mu.Lock()
+	c.paths = append(c.paths, path)
+	c.mu.Unlock()
+	c.c <- path
+}
+
+func (c *changes) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.paths)
+}
+
+// expect waits for the change of the path. Changes of other paths fail the test.
+func (c *changes) expect(t *testing.T, path string) {
+	t.Helper()
+	select {
+	case p := <-c.c:
+		if p != path {
+			t.Fatalf("changed %q, want %q", p, path)
+		}
+	case <-time.After(testWait):
+		t.Fatalf("change of %q is not reported", path)
+	}
+}
+
+// expectNone checks that no change is reported for a while.
+func (c *changes) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case p := <-c.c:
+		t.Fatalf("unexpected change of %q", p)
+	case <-time.After(testQuiet):
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startWatcher(t *testing.T, mode string, paths ...string) (*FileWatcher, *changes) {
+	t.Helper()
+	w, err := NewFileWatcher(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Mode, w.Interval, w.Debounce = mode, testInterval, testDebounce
+	c := newChanges()
+	w.Watch(context.Background(), c.callback)
+	t.Cleanup(w.Stop)
+	// let the watcher take the initial snapshot
+	time.Sleep(testInterval)
+	return w, c
+}
+
+var watchModes = []string{WatchEvents, WatchPolling}
+
+func TestFileWatcherWrite(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "instructions.txt")
+			writeFile(t, path, "v1")
+			_, c := startWatcher(t, mode, path)
+			c.expectNone(t)
+			writeFile(t, path, "version 2")
+			c.expect(t, path)
+			c.expectNone(t)
+		})
+	}
+}
+
+func TestFileWatcherIgnoresOtherFiles(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "instructions.txt")
+			writeFile(t, path, "v1")
+			_, c := startWatcher(t, mode, path)
+			writeFile(t, filepath.Join(dir, "other.txt"), "other")
+			c.expectNone(t)
+		})
+	}
+}
+
+func TestFileWatcherDebounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instructions.txt")
+	writeFile(t, path, "v1")
+	w, err := NewFileWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Mode, w.Interval, w.Debounce = WatchEvents, testInterval, 300*time.Millisecond
+	c := newChanges()
+	w.Watch(context.Background(), c.callback)
+	t.Cleanup(w.Stop)
+	time.Sleep(testInterval)
+	// the writes are closer to each other than the debounce time
+	for i := 0; i < 5; i++ {
+		writeFile(t, path, "version "+string(rune('a'+i)))
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.expect(t, path)
+	c.expectNone(t)
+}
+
+func TestFileWatcherRenameReplace(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "instructions.txt")
+			writeFile(t, path, "v1")
+			_, c := startWatcher(t, mode, path)
+			// editors and Kubernetes replace the file by renaming a new one over it
+			tmp := filepath.Join(dir, ".instructions.txt.tmp")
+			writeFile(t, tmp, "v2")
+			if err := os.Rename(tmp, path); err != nil {
+				t.Fatal(err)
+			}
+			c.expect(t, path)
+			// the replaced file is still watched
+			writeFile(t, path, "version 3")
+			c.expect(t, path)
+		})
+	}
+}
+
+func TestFileWatcherRemoveAndRecreateFile(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "instructions.txt")
+			writeFile(t, path, "v1")
+			_, c := startWatcher(t, mode, path)
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			// removed files are not reported
+			c.expectNone(t)
+			writeFile(t, path, "v2")
+			c.expect(t, path)
+		})
+	}
+}
+
+func TestFileWatcherDirectory(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			existing := filepath.Join(dir, "business.txt")
+			writeFile(t, existing, "v1")
+			_, c := startWatcher(t, mode, dir)
+			added := filepath.Join(dir, "family.txt")
+			writeFile(t, added, "v1")
+			c.expect(t, added)
+			writeFile(t, existing, "version 2")
+			c.expect(t, existing)
+			// subdirectories are not reported
+			if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			c.expectNone(t)
+		})
+	}
+}
+
+func TestFileWatcherRemoveAndRecreateDirectory(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "personas")
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "business.txt")
+			writeFile(t, path, "v1")
+			_, c := startWatcher(t, mode, dir)
+			if err := os.RemoveAll(dir); err != nil {
+				t.Fatal(err)
+			}
+			c.expectNone(t)
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, path, "v2")
+			c.expect(t, path)
+			// the recreated directory is watched again
+			added := filepath.Join(dir, "family.txt")
+			writeFile(t, added, "v1")
+			c.expect(t, added)
+		})
+	}
+}
+
+func TestFileWatcherMultiplePaths(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			root := t.TempDir()
+			file := filepath.Join(root, "instructions.txt")
+			writeFile(t, file, "v1")
+			dir := filepath.Join(root, "personas")
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			_, c := startWatcher(t, mode, file, dir)
+			writeFile(t, file, "version 2")
+			c.expect(t, file)
+			persona := filepath.Join(dir, "business.txt")
+			writeFile(t, persona, "v1")
+			c.expect(t, persona)
+		})
+	}
+}
+
+func TestFileWatcherStop(t *testing.T) {
+	for _, mode := range watchModes {
+		t.Run(mode, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "instructions.txt")
+			writeFile(t, path, "v1")
+			w, c := startWatcher(t, mode, path)
+			w.Stop()
+			// Stop can be called again
+			w.Stop()
+			writeFile(t, path, "version 2")
+			time.Sleep(testQuiet)
+			if n := c.count(); n != 0 {
+				t.Errorf("%d changes reported after Stop", n)
+			}
+		})
+	}
+}
+
+func TestFileWatcherContextCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instructions.txt")
+	writeFile(t, path, "v1")
+	w, err := NewFileWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Mode, w.Interval, w.Debounce = WatchEvents, testInterval, testDebounce
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newChanges()
+	w.Watch(ctx, c.callback)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testWait):
+		t.Fatal("Stop after the context is cancelled does not return")
+	}
+	writeFile(t, path, "version 2")
+	time.Sleep(testQuiet)
+	if n := c.count(); n != 0 {
+		t.Errorf("%d changes reported after the context is cancelled", n)
+	}
+}
+
+func TestFileWatcherRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instructions.txt")
+	writeFile(t, path, "v1")
+	w, first := startWatcher(t, WatchEvents, path)
+	second := newChanges()
+	// Watch again replaces the callback
+	w.Watch(context.Background(), second.callback)
+	time.Sleep(testInterval)
+	writeFile(t, path, "version 2")
+	second.expect(t, path)
+	if n := first.count(); n != 0 {
+		t.Errorf("the first callback got %d changes", n)
+	}
+}
+
+func TestNewFileWatcherErrors(t *testing.T) {
+	if _, err := NewFileWatcher(); err == nil {
+		t.Error("NewFileWatcher() without paths succeeded")
+	}
+	if _, err := NewFileWatcher(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewFileWatcher() of missing file succeeded")
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import "syscall"
+
+// Magic numbers of the file systems that do not deliver inotify events for remote changes.
+var remoteFileSystems = map[uint32]string{
+	0x65735546: "fuse",
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+}
+
+// remoteFileSystem returns the type of the file system of the path if it is a network or FUSE file system,
+// e.g. Cloud Storage volume mounted with Cloud Storage FUSE.
+func remoteFileSystem(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	fsType, ok := remoteFileSystems[uint32(st.Type)]
+	return fsType, ok
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package utils
+
+// remoteFileSystem is implemented only for Linux. Use WatchPolling mode for remote file systems on other platforms.
+func remoteFileSystem(string) (string, bool) {
+	return "", false
+}
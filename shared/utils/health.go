@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/shared/config"
+)
+
+const (
+	// DefaultProbeTTL is the time during which the result of the probe is reused, so frequent
+	// readiness checks do not call the model or the databases on every request.
+	DefaultProbeTTL = 30 * time.Second
+	// DefaultProbeTimeout bounds each run of the probe.
+	DefaultProbeTimeout = 5 * time.Second
+
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// Version is the version of the service binary. Set it at build time with
+// -ldflags "-X github.com/minherz/aichallenges/shared/utils.Version=<version>".
+var Version = "dev"
+
+// ProbeStatus is the result of the dependency check.
+type ProbeStatus struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Latency is the duration of the check in milliseconds
+	Latency int64 `json:"latency_ms"`
+}
+
+// ReadinessResponse is the response of /readyz.
+type ReadinessResponse struct {
+	Status string        `json:"status"`
+	Probes []ProbeStatus `json:"probes,omitempty"`
+}
+
+// VersionResponse is the response of /version.
+type VersionResponse struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	// Revision, BuildTime and Modified are read from the VCS information of the binary when it is available
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	// Models maps the role of the model, e.g. "chat" or "embedding", to its name
+	Models map[string]string `json:"models,omitempty"`
+	// Config is the configuration loaded at startup; secrets are masked
+	Config []config.Setting `json:"config,omitempty"`
+}
+
+type probe struct {
+	name  string
+	check func(ctx context.Context) error
+	// mu serializes the runs of the check, so concurrent requests share the result
+	mu   sync.Mutex
+	last *ProbeStatus
+}
+
+// Health serves the liveness, readiness and version endpoints.
+// Liveness only tells that the server responds. Readiness runs the probes of the dependencies
+// and caches their results for TTL. Health is safe for concurrent use.
+type Health struct {
+	// TTL is the time during which the probe result is reused; 0 uses DefaultProbeTTL
+	TTL time.Duration
+	// Timeout bounds each run of the probe; 0 uses DefaultProbeTimeout
+	Timeout time.Duration
+
+	service  string
+	settings []config.Setting
+	mu       sync.RWMutex
+	models   map[string]string
+	probes   []*probe
+}
+
+// NewHealth returns the health endpoints of the service with the configuration settings reported by /version.
+func NewHealth(service string, settings []config.Setting) *Health {
+	return &Health{service: service, settings: settings, models: make(map[string]string)}
+}
+
+// AddProbe adds the dependency check that is run by /readyz. The check should be cheap
+// because it is called with the real dependency at most once per TTL.
+func (h *Health) AddProbe(name string, check func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probes = append(h.probes, &probe{name: name, check: check})
+}
+
+// SetModel sets the name of the model with the role that is reported by /version.
+func (h *Health) SetModel(role, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.models[role] = name
+}
+
+// Register sets up the GET /healthz, /readyz and /version handlers.
+func (h *Health) Register(e *echo.Echo) {
+	e.GET("/healthz", h.onHealth)
+	e.GET("/readyz", h.onReady)
+	e.GET("/version", h.onVersion)
+}
+
+// Ready runs the probes concurrently and returns their results in the order they were added.
+func (h *Health) Ready(ctx context.Context) ReadinessResponse {
+	h.mu.RLock()
+	probes := h.probes
+	h.mu.RUnlock()
+
+	r := ReadinessResponse{Status: statusOK, Probes: make([]ProbeStatus, len(probes))}
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Probes[i] = h.run(ctx, p)
+		}()
+	}
+	wg.Wait()
+	for _, s := range r.Probes {
+		if s.Status != statusOK {
+			r.Status = statusError
+		}
+	}
+	return r
+}
+
+// run returns the cached result of the probe or runs the check if the result is older than TTL.
+func (h *Health) run(ctx context.Context, p *probe) ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && time.Since(p.last.CheckedAt) < h.ttl() {
+		return *p.last
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	start := time.Now()
+	err := p.check(checkCtx)
+	s := &ProbeStatus{Name: p.name, Status: statusOK, CheckedAt: start, Latency: time.Since(start).Milliseconds()}
+	if err != nil {
+		s.Status, s.Error = statusError, err.Error()
+	}
+	if ctx.Err() == nil {
+		// the result of the check canceled by the client is not cached
+		p.last = s
+	}
+	return *s
+}
+
+func (h *Health) onHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": statusOK})
+}
+
+func (h *Health) onReady(c echo.Context) error {
+	r := h.Ready(c.Request().Context())
+	code := http.StatusOK
+	if r.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(code, r)
+}
+
+func (h *Health) onVersion(c echo.Context) error {
+	r := VersionResponse{Service: h.service, Version: Version, GoVersion: runtime.Version(), Config: h.settings}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				r.Revision = s.Value
+			case "vcs.time":
+				r.BuildTime = s.Value
+			case "vcs.modified":
+				r.Modified = s.Value == "true"
+			}
+		}
+	}
+	h.mu.RLock()
+	r.Models = make(map[string]string, len(h.models))
+	for role, name := range h.models {
+		r.Models[role] = name
+	}
+	h.mu.RUnlock()
+	return c.JSON(http.StatusOK, r)
+}
+
+func (h *Health) ttl() time.Duration {
+	if h.TTL > 0 {
+		return h.TTL
+	}
+	return DefaultProbeTTL
+}
+
+func (h *Health) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultProbeTimeout
+}
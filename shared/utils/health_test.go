@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/minherz/aichallenges/shared/config"
+)
+
+// countingProbe counts the runs of the check and returns err.
+type countingProbe struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (p *countingProbe) check(context.Context) error {
+	p.calls.Add(1)
+	return p.err
+}
+
+func readyz(t *testing.T, h *Health) (int, http.Header, ReadinessResponse) {
+	t.Helper()
+	e := echo.New()
+	h.Register(e)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var r ReadinessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, rec.Header(), r
+}
+
+func TestHealthReady(t *testing.T) {
+	h := NewHealth("test", nil)
+	model, index := &countingProbe{}, &countingProbe{}
+	h.AddProbe("model", model.check)
+	h.AddProbe("index", index.check)
+
+	code, header, r := readyz(t, h)
+	if code != http.StatusOK || r.Status != statusOK {
+		t.Fatalf("GET /readyz = %d %+v", code, r)
+	}
+	if len(r.Probes) != 2 || r.Probes[0].Name != "model" || r.Probes[1].Name != "index" {
+		t.Errorf("probes = %+v, want model and index in order", r.Probes)
+	}
+	for _, s := range r.Probes {
+		if s.Status != statusOK || s.Error != "" || s.CheckedAt.IsZero() {
+			t.Errorf("probe = %+v", s)
+		}
+	}
+	if cc := header.Get(echo.HeaderCacheControl); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+}
+
+func TestHealthReadyCache(t *testing.T) {
+	h := NewHealth("test", nil)
+	p := &countingProbe{}
+	h.AddProbe("model", p.check)
+
+	first := h.Ready(context.Background())
+	second := h.Ready(context.Background())
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("check is called %d times within TTL, want 1", n)
+	}
+	if !second.Probes[0].CheckedAt.Equal(first.Probes[0].CheckedAt) {
+		t.Errorf("second result is checked at %v, want the cached %v", second.Probes[0].CheckedAt, first.Probes[0].CheckedAt)
+	}
+
+	// the result older than TTL is checked again
+	h.TTL = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	h.Ready(context.Background())
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("check is called %d times after TTL, want 2", n)
+	}
+}
+
+func TestHealthReadyFailure(t *testing.T) {
+	h := NewHealth("test", nil)
+	ok, failed := &countingProbe{}, &countingProbe{err: errors.New("index is unavailable")}
+	h.AddProbe("model", ok.check)
+	h.AddProbe("index", failed.check)
+
+	code, _, r := readyz(t, h)
+	if code != http.StatusServiceUnavailable || r.Status != statusError {
+		t.Fatalf("GET /readyz = %d %+v, want 503", code, r)
+	}
+	if s := r.Probes[0]; s.Status != statusOK || s.Error != "" {
+		t.Errorf("model probe = %+v, want ok", s)
+	}
+	if s := r.Probes[1]; s.Status != statusError || s.Error != "index is unavailable" {
+		t.Errorf("index probe = %+v, want the error", s)
+	}
+	// the failure is cached like the success
+	readyz(t, h)
+	if n := failed.calls.Load(); n != 1 {
+		t.Errorf("failed check is called %d times within TTL, want 1", n)
+	}
+}
+
+func TestHealthReadyTimeout(t *testing.T) {
+	h := NewHealth("test", nil)
+	h.Timeout = 10 * time.Millisecond
+	h.AddProbe("model", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	r := h.Ready(context.Background())
+	if s := r.Probes[0]; r.Status != statusError || s.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Ready() = %+v, want the deadline error", r)
+	}
+}
+
+func TestHealthReadyCanceled(t *testing.T) {
+	h := NewHealth("test", nil)
+	p := &countingProbe{}
+	h.AddProbe("model", p.check)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Ready(ctx)
+	// the result of the request canceled by the client is not cached
+	if r := h.Ready(context.Background()); r.Status != statusOK {
+		t.Errorf("Ready() = %+v", r)
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("check is called %d times, want 2", n)
+	}
+}
+
+func TestHealthReadyConcurrent(t *testing.T) {
+	h := NewHealth("test", nil)
+	release := make(chan struct{})
+	var model, index atomic.Int32
+	h.AddProbe("model", func(context.Context) error {
+		model.Add(1)
+		<-release
+		return nil
+	})
+	h.AddProbe("index", func(context.Context) error {
+		index.Add(1)
+		<-release
+		return nil
+	})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]ReadinessResponse, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.Ready(context.Background())
+		}()
+	}
+	// both probes run at the same time, so neither blocks the other
+	deadline := time.Now().Add(3 * time.Second)
+	for model.Load() == 0 || index.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("probes are not run concurrently")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	// the callers that waited for the running check share its result
+	if m, i := model.Load(), index.Load(); m != 1 || i != 1 {
+		t.Errorf("checks are called %d and %d times by %d callers, want 1", m, i, callers)
+	}
+	for _, r := range results {
+		if r.Status != statusOK || len(r.Probes) != 2 || !r.Probes[0].CheckedAt.Equal(results[0].Probes[0].CheckedAt) {
+			t.Errorf("Ready() = %+v, want the shared result", r)
+		}
+	}
+}
+
+func TestHealthVersion(t *testing.T) {
+	settings := []config.Setting{{Key: "model.name", Value: "gemini", Source: config.SourceFile}}
+	h := NewHealth("test", settings)
+	h.SetModel("chat", "gemini")
+	e := echo.New()
+	h.Register(e)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var r VersionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if r.Service != "test" || r.Version != Version || r.GoVersion == "" || r.Models["chat"] != "gemini" ||
+		len(r.Config) != 1 || r.Config[0].Key != "model.name" {
+		t.Errorf("GET /version = %+v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d", rec.Code)
+	}
+}
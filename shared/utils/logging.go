@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+)
+
+// SetupLogger sets the default logger to write JSON records with the field names that Cloud Logging
+// recognizes in structured logs. It returns the log level that can be changed while the service runs.
+func SetupLogger() *slog.LevelVar {
+	level := &slog.LevelVar{}
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(group []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case slog.LevelKey:
+				a.Key = "severity"
+				if level := a.Value.Any().(slog.Level); level == slog.LevelWarn {
+					a.Value = slog.StringValue("WARNING")
+				}
+			case slog.MessageKey:
+				a.Key = "message"
+			case slog.TimeKey:
+				a.Key = "timestamp"
+			}
+			return a
+		},
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, opts)))
+	return level
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultMetadataTimeout bounds each lookup of the metadata server, so the services start outside of Google Cloud.
+const DefaultMetadataTimeout = 3 * time.Second
+
+var (
+	projectEnvVars = []string{"PROJECT_ID", "GOOGLE_CLOUD_PROJECT"}
+	regionEnvVars  = []string{"REGION_NAME"}
+)
+
+// MetadataClient reads the values of the metadata server. *metadata.Client implements it.
+// Use metadata.NewClient with GCE_METADATA_HOST environment variable to call a fake metadata server.
+type MetadataClient interface {
+	GetWithContext(ctx context.Context, suffix string) (string, error)
+}
+
+// Location is the project ID and the region of the service.
+type Location struct {
+	ProjectID string
+	Region    string
+}
+
+// RegisterFlags defines -project and -region flags that set the location.
+func (l *Location) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.ProjectID, "project", "", "Google Cloud project ID")
+	fs.StringVar(&l.Region, "region", "", "Google Cloud region")
+}
+
+// Environment discovers the project ID and the region of the service. The first non-empty value is used
+// in the order: the flags, the configuration, the environment variables, the metadata server and, for the
+// project ID only, the project of the application default credentials.
+// The discovered values are cached. Environment is safe for concurrent use.
+type Environment struct {
+	Flags  Location
+	Config Location
+	// Metadata is the client of the metadata server; nil uses the default client
+	Metadata MetadataClient
+	// Credentials returns the project of the application default credentials; nil uses google.FindDefaultCredentials
+	Credentials func(ctx context.Context) (string, error)
+	// Timeout bounds each lookup of the metadata server or the credentials; 0 uses DefaultMetadataTimeout
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	cached Location
+}
+
+// ProjectID returns the ID of the current project.
+func (e *Environment) ProjectID(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cached.ProjectID != "" {
+		return e.cached.ProjectID, nil
+	}
+	var err error
+	v := lookup(projectEnvVars, e.Flags.ProjectID, e.Config.ProjectID)
+	if v == "" {
+		v, err = e.metadata(ctx, "project/project-id")
+	}
+	if v == "" {
+		adc, adcErr := e.credentialsProject(ctx)
+		if adc == "" {
+			return "", errors.Join(errors.New("project ID is not found"), err, adcErr)
+		}
+		v = adc
+	}
+	e.cached.ProjectID = v
+	return v, nil
+}
+
+// Region returns the region of the current service.
+func (e *Environment) Region(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cached.Region != "" {
+		return e.cached.Region, nil
+	}
+	var err error
+	v := lookup(regionEnvVars, e.Flags.Region, e.Config.Region)
+	if v == "" {
+		v, err = e.metadata(ctx, "instance/region")
+		// parse region from fully qualified name projects/<projNum>/regions/<region>
+		if pos := strings.LastIndex(v, "/"); pos >= 0 {
+			v = v[pos+1:]
+		}
+	}
+	if v == "" {
+		return "", errors.Join(errors.New("region is not found"), err)
+	}
+	e.cached.Region = v
+	return v, nil
+}
+
+// lookup returns the first non-empty of the values or of the environment variables.
+func lookup(envVars []string, values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	for _, name := range envVars {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (e *Environment) metadata(ctx context.Context, suffix string) (string, error) {
+	c := e.Metadata
+	if c == nil {
+		c = metadata.NewClient(nil)
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout())
+	defer cancel()
+	v, err := c.GetWithContext(ctx, suffix)
+	if err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	return strings.TrimSpace(v), nil
+}
+
+func (e *Environment) credentialsProject(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout())
+	defer cancel()
+	if e.Credentials != nil {
+		return e.Credentials(ctx)
+	}
+	creds, err := google.FindDefaultCredentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("application default credentials: %w", err)
+	}
+	return creds.ProjectID, nil
+}
+
+func (e *Environment) timeout() time.Duration {
+	if e.Timeout > 0 {
+		return e.Timeout
+	}
+	return DefaultMetadataTimeout
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// fakeMetadata serves the project ID and the region like the metadata server.
+type fakeMetadata struct {
+	projectID string
+	region    string
+	// hang blocks the requests until the client gives up
+	hang  bool
+	calls atomic.Int32
+}
+
+func (f *fakeMetadata) start(t *testing.T) MetadataClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls.Add(1)
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor header", http.StatusForbidden)
+			return
+		}
+		if f.hang {
+			<-r.Context().Done()
+			return
+		}
+		var v string
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			v = f.projectID
+		case "/computeMetadata/v1/instance/region":
+			v = f.region
+		}
+		if v == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		w.Write([]byte(v))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	return metadata.NewClient(srv.Client())
+}
+
+// clearEnv unsets the environment variables that set the location.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range append(projectEnvVars, regionEnvVars...) {
+		t.Setenv(name, "")
+	}
+}
+
+func TestEnvironmentPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  Location
+		config Location
+		env    map[string]string
+		// metadata is the project ID and the region of the metadata server
+		metadata      Location
+		adc           string
+		wantProjectID string
+		wantRegion    string
+	}{
+		{
+			name:          "flags",
+			flags:         Location{ProjectID: "flag-project", Region: "flag-region"},
+			config:        Location{ProjectID: "config-project", Region: "config-region"},
+			env:           map[string]string{"PROJECT_ID": "env-project", "REGION_NAME": "env-region"},
+			metadata:      Location{ProjectID: "metadata-project", Region: "projects/1/regions/metadata-region"},
+			adc:           "adc-project",
+			wantProjectID: "flag-project",
+			wantRegion:    "flag-region",
+		},
+		{
+			name:          "config",
+			config:        Location{ProjectID: "config-project", Region: "config-region"},
+			env:           map[string]string{"PROJECT_ID": "env-project", "REGION_NAME": "env-region"},
+			metadata:      Location{ProjectID: "metadata-project", Region: "projects/1/regions/metadata-region"},
+			adc:           "adc-project",
+			wantProjectID: "config-project",
+			wantRegion:    "config-region",
+		},
+		{
+			name:          "environment",
+			env:           map[string]string{"PROJECT_ID": "env-project", "GOOGLE_CLOUD_PROJECT": "gcp-project", "REGION_NAME": "env-region"},
+			metadata:      Location{ProjectID: "metadata-project", Region: "projects/1/regions/metadata-region"},
+			adc:           "adc-project",
+			wantProjectID: "env-project",
+			wantRegion:    "env-region",
+		},
+		{
+			name:          "google cloud project",
+			env:           map[string]string{"GOOGLE_CLOUD_PROJECT": "gcp-project"},
+			metadata:      Location{ProjectID: "metadata-project", Region: "projects/1/regions/metadata-region"},
+			wantProjectID: "gcp-project",
+			wantRegion:    "metadata-region",
+		},
+		{
+			name:          "metadata",
+			metadata:      Location{ProjectID: "metadata-project", Region: "projects/1/regions/metadata-region"},
+			adc:           "adc-project",
+			wantProjectID: "metadata-project",
+			wantRegion:    "metadata-region",
+		},
+		{
+			name:          "application default credentials",
+			adc:           "adc-project",
+			wantProjectID: "adc-project",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			f := &fakeMetadata{projectID: tc.metadata.ProjectID, region: tc.metadata.Region}
+			e := &Environment{
+				Flags:    tc.flags,
+				Config:   tc.config,
+				Metadata: f.start(t),
+				Credentials: func(context.Context) (string, error) {
+					if tc.adc == "" {
+						return "", errors.New("no credentials")
+					}
+					return tc.adc, nil
+				},
+			}
+			ctx := context.Background()
+			projectID, err := e.ProjectID(ctx)
+			if err != nil || projectID != tc.wantProjectID {
+				t.Errorf("ProjectID() = %q, %v, want %q", projectID, err, tc.wantProjectID)
+			}
+			region, err := e.Region(ctx)
+			if tc.wantRegion == "" {
+				if err == nil {
+					t.Errorf("Region() = %q, want error", region)
+				}
+				return
+			}
+			if err != nil || region != tc.wantRegion {
+				t.Errorf("Region() = %q, %v, want %q", region, err, tc.wantRegion)
+			}
+		})
+	}
+}
+
+func TestEnvironmentNotFound(t *testing.T) {
+	clearEnv(t)
+	f := &fakeMetadata{}
+	e := &Environment{
+		Metadata:    f.start(t),
+		Credentials: func(context.Context) (string, error) { return "", errors.New("no credentials") },
+	}
+	_, err := e.ProjectID(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "project ID is not found") || !strings.Contains(err.Error(), "no credentials") {
+		t.Errorf("ProjectID() error = %v, want not found error with the causes", err)
+	}
+}
+
+func TestEnvironmentTimeout(t *testing.T) {
+	clearEnv(t)
+	f := &fakeMetadata{hang: true}
+	e := &Environment{
+		Metadata:    f.start(t),
+		Credentials: func(context.Context) (string, error) { return "adc-project", nil },
+		Timeout:     100 * time.Millisecond,
+	}
+	start := time.Now()
+	projectID, err := e.ProjectID(context.Background())
+	if err != nil || projectID != "adc-project" {
+		t.Errorf("ProjectID() = %q, %v, want %q", projectID, err, "adc-project")
+	}
+	if _, err := e.Region(context.Background()); err == nil {
+		t.Error("Region() of hanging metadata server succeeded")
+	}
+	// two lookups of the metadata server time out
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("lookups took %v, want about %v", d, 2*e.Timeout)
+	}
+}
+
+func TestEnvironmentConcurrent(t *testing.T) {
+	clearEnv(t)
+	f := &fakeMetadata{projectID: "metadata-project", region: "projects/1/regions/metadata-region"}
+	e := &Environment{Metadata: f.start(t)}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			projectID, err := e.ProjectID(context.Background())
+			if err != nil || projectID != "metadata-project" {
+				t.Errorf("ProjectID() = %q, %v", projectID, err)
+			}
+			region, err := e.Region(context.Background())
+			if err != nil || region != "metadata-region" {
+				t.Errorf("Region() = %q, %v", region, err)
+			}
+		}()
+	}
+	wg.Wait()
+	// the values are cached after the first lookup
+	if n := f.calls.Load(); n != 2 {
+		t.Errorf("metadata server got %d requests, want 2", n)
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/minherz/aichallenges/shared/config"
+)
+
+// ShutdownTimeout is the time that the server waits for the active requests to complete at shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// NewServer returns the echo server that serves the static files of the web UI from assets.
+// Debug enables the request logging. Requests with the body larger than BodyLimit are rejected
+// with 413 without reading the rest of the body.
+func NewServer(cfg config.Server, assets *Assets) *echo.Echo {
+	e := echo.New()
+	if cfg.Debug {
+		e.Use(middleware.Logger())
+	}
+	e.Use(
+		middleware.BodyLimit(strconv.FormatInt(cfg.BodyLimit, 10)),
+		middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins: []string{"*"},
+		}),
+		middleware.GzipWithConfig(middleware.GzipConfig{
+			Level: 5,
+		}),
+		middleware.Secure(),
+		assets.Middleware(),
+	)
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(
+		echo.TrustLoopback(false),   // e.g. ipv4 start with 127.
+		echo.TrustLinkLocal(false),  // e.g. ipv4 start with 169.254
+		echo.TrustPrivateNet(false), // e.g. ipv4 start with 10. or 192.168
+	)
+	return e
+}
+
+// SignalContext returns the context that is canceled when the process receives SIGINT or SIGTERM.
+// Cloud Run sends SIGTERM before it stops the container.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Serve starts the server on the port and blocks until ctx is done. Then it shuts down the server
+// waiting up to ShutdownTimeout for the active requests. It returns the error if the server fails to start.
+func Serve(ctx context.Context, e *echo.Echo, port string) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- e.Start(":" + port)
+	}()
+	select {
+	case err := <-errc:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return e.Shutdown(ctx)
+}